@@ -5,10 +5,18 @@ import (
 )
 
 func main() {
+	entities.HandleVersionCommand()
 	client, err := entities.NewClient()
 	if err != nil {
 		client.ErrorLog.Println("Error while starting client:", err.Error())
 		client.Stop(false, 1)
 	}
-	client.RunAlarmer(false)
+	client.HandleInterrupts()
+	client.WithMetadata(map[string]string{entities.RoleMetadataKey: "alarm-button-off"})
+	err = client.RunAlarmer(false)
+	if err != nil {
+		client.ErrorLog.Println("Error while sending the alarm request:", err.Error())
+		client.Stop(false, 1)
+	}
+	client.Stop(false)
 }
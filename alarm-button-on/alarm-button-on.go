@@ -5,10 +5,18 @@ import (
 )
 
 func main() {
+	entities.HandleVersionCommand()
 	client, err := entities.NewClient()
 	if err != nil {
 		client.ErrorLog.Println("Error while starting client:", err.Error())
 		client.Stop(false, 1)
 	}
-	client.RunAlarmer(true)
+	client.HandleInterrupts()
+	client.WithMetadata(map[string]string{entities.RoleMetadataKey: "alarm-button-on"})
+	err = client.RunAlarmer(true)
+	if err != nil {
+		client.ErrorLog.Println("Error while sending the alarm request:", err.Error())
+		client.Stop(false, 1)
+	}
+	client.Stop(false)
 }
@@ -1,14 +1,50 @@
 package main
 
 import (
+	"errors"
+	"flag"
+
 	"github.com/oshokin/alarm-button/entities"
 )
 
 func main() {
+	entities.HandleVersionCommand()
+	entities.HandleDoctorCommand()
+	isServicePointer := flag.Bool("service", false,
+		"run as a Windows service, the service control manager stops the checker (ignored on other OS)")
 	client, err := entities.NewClient()
 	if err != nil {
 		client.ErrorLog.Println("Error while starting client:", err.Error())
 		client.Stop(false, 1)
 	}
-	client.RunChecker()
+	client.HandleInterrupts()
+	client.HandleReload()
+	client.WithMetadata(map[string]string{entities.RoleMetadataKey: "checker"})
+	if !*isServicePointer {
+		runChecker(client)
+		return
+	}
+	err = client.RunAsService("alarm-checker", func() {
+		runChecker(client)
+	})
+	if err != nil {
+		client.ErrorLog.Println("Error while starting the service:", err.Error())
+		client.Stop(false, 1)
+	}
+}
+
+func runChecker(client *entities.Client) {
+	err := client.RunChecker()
+	if errors.Is(err, entities.ErrAlarmPressed) {
+		client.Stop(false, entities.AlarmPressedExitCode)
+	}
+	if errors.Is(err, entities.ErrShutdownBlocked) {
+		client.ErrorLog.Println("The alarm can't be acted on:", err.Error())
+		client.Stop(false, entities.ShutdownBlockedExitCode)
+	}
+	if err != nil {
+		client.ErrorLog.Println("Error while checking the alarm state:", err.Error())
+		client.Stop(false, 1)
+	}
+	client.Stop(false)
 }
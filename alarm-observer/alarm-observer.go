@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/oshokin/alarm-button/entities"
+)
+
+type stateQuerier interface {
+	QueryState() (*entities.StateResponse, error)
+}
+
+type Observer struct {
+	querier      stateQuerier
+	pollInterval time.Duration
+	isJSONOutput bool
+	InfoLog      *log.Logger
+	ErrorLog     *log.Logger
+	lastState    *entities.StateResponse
+}
+
+func main() {
+	entities.HandleVersionCommand()
+	isJSONOutput := flag.Bool("json", false, "print every state change to the standard output as a JSON line")
+	client, err := entities.NewClientWithLogOutput(os.Stderr)
+	if err != nil {
+		client.ErrorLog.Println("Error while starting observer:", err.Error())
+		os.Exit(1)
+	}
+	client.HandleInterrupts()
+	client.WithMetadata(map[string]string{entities.RoleMetadataKey: "observer"})
+	observer := &Observer{
+		querier:      client,
+		pollInterval: client.Options.PollInterval,
+		isJSONOutput: *isJSONOutput,
+		InfoLog:      client.InfoLog,
+		ErrorLog:     client.ErrorLog,
+	}
+	observer.InfoLog.Println("The observer is running, this PC will never be turned off by the alarm button")
+	observer.Run()
+}
+
+func (observer *Observer) Run() {
+	for {
+		stateResponse, err := observer.querier.QueryState()
+		if err != nil {
+			observer.ErrorLog.Println("Error while requesting the alarm state:", err.Error())
+		} else {
+			observer.processState(stateResponse)
+		}
+		time.Sleep(observer.pollInterval)
+	}
+}
+
+func (observer *Observer) processState(stateResponse *entities.StateResponse) {
+	if observer.lastState != nil && observer.lastState.Sequence == stateResponse.Sequence &&
+		observer.lastState.IsAlarmButtonPressed == stateResponse.IsAlarmButtonPressed {
+		return
+	}
+	observer.lastState = stateResponse
+	observer.InfoLog.Println("The alarm state was observed:", stateResponse.String())
+	if !observer.isJSONOutput {
+		return
+	}
+	output, err := json.Marshal(stateResponse)
+	if err != nil {
+		observer.ErrorLog.Println("Error while converting data:", err.Error())
+		return
+	}
+	fmt.Println(string(output))
+}
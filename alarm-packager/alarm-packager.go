@@ -1,27 +1,50 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
 	"encoding/base64"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 
+	"github.com/hashicorp/go-version"
 	"github.com/oshokin/alarm-button/entities"
 	"gopkg.in/yaml.v3"
 )
 
+type Options struct {
+	Upload        bool
+	Verify        bool
+	Gzip          bool
+	Version       string
+	HashAlgorithm string
+	Instructions  string
+	NoCache       bool
+	ProbeVersion  bool
+}
+
 type Packager struct {
 	UpdateDescription *entities.UpdateDescription
+	Options           *Options
 	InfoLog           *log.Logger
 	ErrorLog          *log.Logger
+	checksumFunction  crypto.Hash
+	checksumCache     *checksumCache
 }
 
 func NewPackager() (*Packager, error) {
 	packager := Packager{
 		UpdateDescription: nil,
+		Options:           definePackagerFlags(),
 		InfoLog:           log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime),
 		ErrorLog:          log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile),
 	}
@@ -30,14 +53,70 @@ func NewPackager() (*Packager, error) {
 		return &packager, errors.New("the updater is running now")
 	}
 	err := entities.ReadCommonSettingsFromArgs()
-	return &packager, err
+	if err != nil {
+		return &packager, err
+	}
+	if packager.Options.Version != "" {
+		_, err = version.NewVersion(packager.Options.Version)
+		if err != nil {
+			return &packager, fmt.Errorf("invalid release version, %s", err.Error())
+		}
+	}
+	packager.checksumFunction, err = entities.GetChecksumFunction(packager.Options.HashAlgorithm)
+	if err != nil {
+		return &packager, err
+	}
+	if !packager.Options.NoCache {
+		packager.checksumCache, err = readChecksumCache()
+		if err != nil {
+			packager.ErrorLog.Println("Error while reading the checksum cache, it will be rebuilt:", err.Error())
+			packager.checksumCache = &checksumCache{Entries: make(map[string]*checksumCacheEntry, 16)}
+		}
+	}
+	return &packager, nil
+}
+
+func definePackagerFlags() *Options {
+	options := &Options{}
+	flag.BoolVar(&options.Upload, "upload", false,
+		"upload the update files to the updates folder (http, https and s3 folders are supported)")
+	flag.BoolVar(&options.Verify, "verify", false,
+		"verify that the uploaded updates folder is consistent instead of packaging")
+	flag.BoolVar(&options.Gzip, "gzip", false,
+		"compress the update files with gzip before uploading them")
+	flag.StringVar(&options.Version, "version", "",
+		fmt.Sprintf("release version written to the update description (default %s)", entities.CurrentVersion))
+	flag.StringVar(&options.HashAlgorithm, "hash", entities.SHA512HashAlgorithm,
+		"hash algorithm used for the file checksums: sha512 or sha256")
+	flag.StringVar(&options.Instructions, "instructions", "",
+		"write the further actions to this file instead of the log (useful for CI artifacts)")
+	flag.BoolVar(&options.NoCache, "no-cache", false,
+		fmt.Sprintf("recompute all checksums instead of reusing unchanged ones from %s", checksumCacheFileName))
+	flag.BoolVar(&options.ProbeVersion, "probe-version", false,
+		"let the updater run the installed executables with the version command when it has no recorded version "+
+			"(only when every installed executable supports that command)")
+	return options
 }
 
 func main() {
+	entities.HandleVersionCommand()
 	packager, err := NewPackager()
 	if err != nil {
 		packager.ErrorLog.Fatalln("Error while launching packager:", err.Error())
 	}
+	if packager.Options.Verify {
+		packager.InfoLog.Println("Verifying the updates folder", entities.Settings.ServerUpdateFolder)
+		err = packager.Verify(context.Background())
+		if err != nil {
+			packager.ErrorLog.Fatalln("Error while verifying the updates folder:", err.Error())
+		}
+		packager.InfoLog.Println("The updates folder is consistent")
+		return
+	}
+	if errors.Is(entities.ValidateDownloadFolder(entities.Settings.ServerUpdateFolder), entities.ErrS3UpdateFolder) {
+		packager.ErrorLog.Println("Warning: the updater can't download from s3, " +
+			"set updateFolder in the saved settings to the http(s) address of the bucket")
+	}
 	packager.InfoLog.Println("Saving connection settings to a file")
 	err = entities.SaveCommonSettingsToFile()
 	if err != nil {
@@ -52,16 +131,102 @@ func (packager *Packager) Run() {
 	if err != nil {
 		packager.ErrorLog.Fatalln("Error while preparing the update description:", err.Error())
 	}
+	if packager.checksumCache != nil {
+		err = packager.checksumCache.Save()
+		if err != nil {
+			packager.ErrorLog.Println("Error while saving the checksum cache:", err.Error())
+		}
+	}
 	packager.InfoLog.Println("Saving the update description")
 	err = packager.saveUpdateDescriptionToFile()
 	if err != nil {
 		packager.ErrorLog.Fatalln("Error while saving the update description:", err.Error())
 	}
-	packager.showFurtherActions()
+	if packager.Options.Upload {
+		packager.InfoLog.Println("Uploading the update files to the folder", entities.Settings.ServerUpdateFolder)
+		err = packager.uploadFiles(context.Background())
+		if err != nil {
+			packager.ErrorLog.Fatalln("Error while uploading the update files:", err.Error())
+		}
+		packager.InfoLog.Println("The update files were uploaded successfully")
+		return
+	}
+	if packager.Options.Instructions == "" {
+		packager.InfoLog.Println(packager.getFurtherActions())
+		return
+	}
+	err = os.WriteFile(packager.Options.Instructions, []byte(packager.getFurtherActions()), entities.DefaultFileMode)
+	if err != nil {
+		packager.ErrorLog.Fatalln("Error while saving the further actions:", err.Error())
+	}
+	packager.InfoLog.Printf("The update description is ready, further actions were saved to the file %s\n",
+		packager.Options.Instructions)
+}
+
+func (packager *Packager) getFilesToUpload() []string {
+	filesArray := make([]string, 0, len(packager.UpdateDescription.Files)+1)
+	for fileName := range packager.UpdateDescription.Files {
+		if _, isCompressed := packager.UpdateDescription.Compression[fileName]; isCompressed {
+			fileName += entities.GzipFileExtension
+		}
+		filesArray = append(filesArray, fileName)
+	}
+	filesArray = append(filesArray, entities.VersionFileName)
+	sort.Strings(filesArray)
+	return filesArray
+}
+
+func (packager *Packager) uploadFiles(ctx context.Context) error {
+	uploader, err := newArtifactUploader(entities.Settings.ServerUpdateFolder)
+	if err != nil {
+		return err
+	}
+	for _, fileName := range packager.getFilesToUpload() {
+		contents, err := os.ReadFile(fileName)
+		if err != nil {
+			return err
+		}
+		packager.InfoLog.Printf("Uploading the file %s\n", fileName)
+		err = uploader.Upload(ctx, fileName, contents)
+		if err != nil {
+			return fmt.Errorf("unable to upload the file %s, %w", fileName, err)
+		}
+		uploadedContents, err := uploader.Download(ctx, fileName)
+		if err != nil {
+			return fmt.Errorf("unable to download the uploaded file %s, %w", fileName, err)
+		}
+		isUploadCorrect, err := isChecksumEqual(packager.checksumFunction, contents, uploadedContents)
+		if err != nil {
+			return err
+		}
+		if !isUploadCorrect {
+			return fmt.Errorf("the checksum of the uploaded file %s doesn't match the local file", fileName)
+		}
+	}
+	return nil
+}
+
+func isChecksumEqual(checksumFunction crypto.Hash, firstContents []byte, secondContents []byte) (bool, error) {
+	firstHasher, err := entities.NewChecksumHasher(checksumFunction)
+	if err != nil {
+		return false, err
+	}
+	firstHasher.Write(firstContents)
+	secondHasher, err := entities.NewChecksumHasher(checksumFunction)
+	if err != nil {
+		return false, err
+	}
+	secondHasher.Write(secondContents)
+	return bytes.Equal(firstHasher.Sum(nil), secondHasher.Sum(nil)), nil
 }
 
 func (packager *Packager) fillUpdateDescription() error {
 	packager.UpdateDescription = entities.NewUpdateDescription()
+	if packager.Options.Version != "" {
+		packager.UpdateDescription.VersionNumber = packager.Options.Version
+	}
+	packager.UpdateDescription.HashAlgorithm = strings.ToLower(packager.Options.HashAlgorithm)
+	packager.UpdateDescription.ProbeVersion = packager.Options.ProbeVersion
 	for key, value := range entities.AllowedUserRoles {
 		packager.UpdateDescription.Roles[key] = value
 	}
@@ -69,18 +234,125 @@ func (packager *Packager) fillUpdateDescription() error {
 		packager.UpdateDescription.Executables[key] = value
 	}
 	for _, fileName := range entities.FilesWithChecksum {
-		if _, err := os.Stat(fileName); os.IsNotExist(err) {
-			return fmt.Errorf(fmt.Sprintf("%s wasn't found", fileName))
+		err := packager.addFileChecksum(fileName)
+		if err != nil {
+			return err
+		}
+	}
+	err := packager.addCustomRoles()
+	if err != nil {
+		return err
+	}
+	err = packager.UpdateDescription.Validate()
+	if err != nil {
+		return fmt.Errorf("the update description is inconsistent, %s", err.Error())
+	}
+	if packager.Options.Gzip {
+		packager.InfoLog.Println("Compressing the update files")
+		return packager.compressFiles()
+	}
+	return nil
+}
+
+func (packager *Packager) addCustomRoles() error {
+	roleDefinitions, err := entities.ReadRoleDefinitionsFromFile()
+	if err != nil {
+		return err
+	}
+	if roleDefinitions == nil {
+		return nil
+	}
+	packager.InfoLog.Println("Adding custom roles from the file", entities.RolesFileName)
+	for userRole, files := range roleDefinitions.Roles {
+		for _, fileName := range files {
+			if _, isChecksumFound := packager.UpdateDescription.Files[fileName]; isChecksumFound {
+				continue
+			}
+			if _, err := os.Stat(fileName); os.IsNotExist(err) {
+				return fmt.Errorf("%s referenced by the role %s wasn't found", fileName, userRole)
+			}
+			err = packager.addFileChecksum(fileName)
+			if err != nil {
+				return err
+			}
+		}
+		packager.UpdateDescription.Roles[userRole] = files
+	}
+	for userRole, executable := range roleDefinitions.Executables {
+		packager.UpdateDescription.Executables[userRole] = executable
+	}
+	for fileName, targetPath := range roleDefinitions.Paths {
+		packager.UpdateDescription.Paths[fileName] = targetPath
+	}
+	return nil
+}
+
+func (packager *Packager) compressFiles() error {
+	for fileName := range packager.UpdateDescription.Files {
+		compressedFileName := fileName + entities.GzipFileExtension
+		err := compressFile(fileName, compressedFileName)
+		if err != nil {
+			return err
 		}
-		fileChecksum, err := entities.GetFileChecksum(fileName)
+		fileChecksum, err := entities.GetFileChecksum(compressedFileName, packager.checksumFunction)
 		if err != nil {
 			return err
 		}
-		packager.UpdateDescription.Files[fileName] = base64.StdEncoding.EncodeToString(fileChecksum)
+		packager.UpdateDescription.Compression[fileName] = entities.GzipCompression
+		packager.UpdateDescription.CompressedFiles[fileName] = base64.StdEncoding.EncodeToString(fileChecksum)
+	}
+	return nil
+}
+
+func compressFile(fileName string, compressedFileName string) error {
+	inputFile, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer inputFile.Close()
+	outputFile, err := os.OpenFile(compressedFileName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, entities.DefaultFileMode)
+	if err != nil {
+		return err
+	}
+	gzipWriter, err := gzip.NewWriterLevel(outputFile, gzip.BestCompression)
+	if err != nil {
+		outputFile.Close()
+		return err
+	}
+	gzipWriter.Name = filepath.Base(fileName)
+	_, err = io.Copy(gzipWriter, inputFile)
+	if err != nil {
+		gzipWriter.Close()
+		outputFile.Close()
+		return err
+	}
+	err = gzipWriter.Close()
+	if err != nil {
+		outputFile.Close()
+		return err
+	}
+	return outputFile.Close()
+}
+
+func (packager *Packager) addFileChecksum(fileName string) error {
+	if _, err := os.Stat(fileName); os.IsNotExist(err) {
+		return fmt.Errorf(fmt.Sprintf("%s wasn't found", fileName))
 	}
+	fileChecksum, err := packager.getFileChecksum(fileName)
+	if err != nil {
+		return err
+	}
+	packager.UpdateDescription.Files[fileName] = base64.StdEncoding.EncodeToString(fileChecksum)
 	return nil
 }
 
+func (packager *Packager) getFileChecksum(fileName string) ([]byte, error) {
+	if packager.checksumCache == nil {
+		return entities.GetFileChecksum(fileName, packager.checksumFunction)
+	}
+	return packager.checksumCache.GetFileChecksum(fileName, packager.checksumFunction)
+}
+
 func (packager *Packager) saveUpdateDescriptionToFile() error {
 	contents, err := yaml.Marshal(packager.UpdateDescription)
 	if err != nil {
@@ -93,13 +365,8 @@ func (packager *Packager) saveUpdateDescriptionToFile() error {
 	return nil
 }
 
-func (packager *Packager) showFurtherActions() {
-	filesArray := make([]string, 0, len(packager.UpdateDescription.Files)+1)
-	for fileName := range packager.UpdateDescription.Files {
-		filesArray = append(filesArray, fileName)
-	}
-	filesArray = append(filesArray, entities.VersionFileName)
-	sort.Strings(filesArray)
+func (packager *Packager) getFurtherActions() string {
+	filesArray := packager.getFilesToUpload()
 	var builder strings.Builder
 	builder.Grow(1024)
 	fmt.Fprintf(&builder, "You should upload the following files to the folder %s:\n", entities.Settings.ServerUpdateFolder)
@@ -120,11 +387,11 @@ func (packager *Packager) showFurtherActions() {
 				fmt.Fprintf(&builder, ",\n%s", fileName)
 			}
 		}
-		if userRole == "client" {
-			fmt.Fprintf(&builder, "\nAt system startup, set the command to run: alarm-updater -type = %s", userRole)
-		} else {
+		if userRole == "server" {
 			fmt.Fprint(&builder, "\nAt system startup, set the command to run: alarm-updater")
+		} else {
+			fmt.Fprintf(&builder, "\nAt system startup, set the command to run: alarm-updater -type = %s", userRole)
 		}
 	}
-	packager.InfoLog.Println(builder.String())
+	return builder.String()
 }
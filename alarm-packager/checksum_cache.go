@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto"
+	"encoding/base64"
+	"os"
+	"time"
+
+	"github.com/oshokin/alarm-button/entities"
+	"gopkg.in/yaml.v3"
+)
+
+const checksumCacheFileName string = "alarm-button-checksum-cache.yaml"
+
+type checksumCache struct {
+	Entries   map[string]*checksumCacheEntry `yaml:"entries"`
+	isChanged bool
+}
+
+type checksumCacheEntry struct {
+	ModTime  time.Time `yaml:"modTime"`
+	Size     int64     `yaml:"size"`
+	Checksum string    `yaml:"checksum"`
+}
+
+func readChecksumCache() (*checksumCache, error) {
+	cache := &checksumCache{Entries: make(map[string]*checksumCacheEntry, 16)}
+	data, err := os.ReadFile(checksumCacheFileName)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(data, cache)
+	if err != nil {
+		return nil, err
+	}
+	if cache.Entries == nil {
+		cache.Entries = make(map[string]*checksumCacheEntry, 16)
+	}
+	return cache, nil
+}
+
+func (cache *checksumCache) GetFileChecksum(fileName string, checksumFunction crypto.Hash) ([]byte, error) {
+	fileInfo, err := os.Stat(fileName)
+	if err != nil {
+		return nil, err
+	}
+	key := checksumFunction.String() + ":" + fileName
+	entry, isEntryFound := cache.Entries[key]
+	if isEntryFound && entry.Size == fileInfo.Size() && entry.ModTime.Equal(fileInfo.ModTime()) {
+		checksum, err := base64.StdEncoding.DecodeString(entry.Checksum)
+		if err == nil {
+			return checksum, nil
+		}
+	}
+	checksum, err := entities.GetFileChecksum(fileName, checksumFunction)
+	if err != nil {
+		return nil, err
+	}
+	cache.Entries[key] = &checksumCacheEntry{
+		ModTime:  fileInfo.ModTime(),
+		Size:     fileInfo.Size(),
+		Checksum: base64.StdEncoding.EncodeToString(checksum),
+	}
+	cache.isChanged = true
+	return checksum, nil
+}
+
+func (cache *checksumCache) Save() error {
+	if !cache.isChanged {
+		return nil
+	}
+	contents, err := yaml.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(checksumCacheFileName, contents, entities.DefaultFileMode)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oshokin/alarm-button/entities"
+)
+
+type artifactUploader interface {
+	Upload(ctx context.Context, fileName string, contents []byte) error
+	Download(ctx context.Context, fileName string) ([]byte, error)
+}
+
+func newArtifactUploader(updateFolder string) (artifactUploader, error) {
+	folderURL, err := url.Parse(updateFolder)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(folderURL.Scheme) {
+	case "http", "https":
+		httpClient, err := entities.NewHTTPClient(entities.Settings)
+		if err != nil {
+			return nil, err
+		}
+		return &httpUploader{
+			updateFolder: updateFolder,
+			folderURL:    folderURL,
+			httpClient:   httpClient,
+		}, nil
+	case "s3":
+		awsSession, err := session.NewSessionWithOptions(session.Options{
+			SharedConfigState: session.SharedConfigEnable,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &s3Uploader{
+			client: s3.New(awsSession),
+			bucket: folderURL.Host,
+			prefix: strings.Trim(folderURL.Path, "/"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("uploading to the folder with the %s scheme is not supported", folderURL.Scheme)
+	}
+}
+
+type httpUploader struct {
+	updateFolder string
+	folderURL    *url.URL
+	httpClient   *http.Client
+}
+
+func (uploader *httpUploader) getFileURL(fileName string) string {
+	fileURL := *uploader.folderURL
+	fileURL.Path = path.Join(fileURL.Path, fileName)
+	return fileURL.String()
+}
+
+func (uploader *httpUploader) Upload(ctx context.Context, fileName string, contents []byte) error {
+	fileURL := uploader.getFileURL(fileName)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPut, fileURL, bytes.NewReader(contents))
+	if err != nil {
+		return err
+	}
+	request.ContentLength = int64(len(contents))
+	entities.SetUpdateHTTPHeaders(request)
+	response, err := uploader.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("%s, %s", fileURL, response.Status)
+	}
+	return nil
+}
+
+func (uploader *httpUploader) Download(ctx context.Context, fileName string) ([]byte, error) {
+	return entities.ReadFileFromUpdateFolder(ctx, uploader.httpClient, uploader.updateFolder, fileName)
+}
+
+type s3Uploader struct {
+	client *s3.S3
+	bucket string
+	prefix string
+}
+
+func (uploader *s3Uploader) Upload(ctx context.Context, fileName string, contents []byte) error {
+	_, err := uploader.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(uploader.bucket),
+		Key:    aws.String(path.Join(uploader.prefix, fileName)),
+		Body:   bytes.NewReader(contents),
+	})
+	return err
+}
+
+func (uploader *s3Uploader) Download(ctx context.Context, fileName string) ([]byte, error) {
+	output, err := uploader.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(uploader.bucket),
+		Key:    aws.String(path.Join(uploader.prefix, fileName)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer output.Body.Close()
+	return io.ReadAll(output.Body)
+}
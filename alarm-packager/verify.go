@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/oshokin/alarm-button/entities"
+	"gopkg.in/yaml.v3"
+)
+
+func (packager *Packager) Verify(ctx context.Context) error {
+	httpClient, err := entities.NewHTTPClient(entities.Settings)
+	if err != nil {
+		return err
+	}
+	updateFolder := entities.Settings.ServerUpdateFolder
+	data, err := entities.ReadFileFromUpdateFolder(ctx, httpClient, updateFolder, entities.VersionFileName)
+	if err != nil {
+		return fmt.Errorf("unable to download the update description, %w", err)
+	}
+	updateDescription := entities.NewUpdateDescription()
+	err = yaml.Unmarshal(data, updateDescription)
+	if err != nil {
+		return fmt.Errorf("invalid update description, %w", err)
+	}
+	err = updateDescription.CheckManifestVersion()
+	if err != nil {
+		return err
+	}
+	checksumFunction, err := updateDescription.GetChecksumFunction()
+	if err != nil {
+		return err
+	}
+	problems := make([]string, 0, 8)
+	fileNames := make([]string, 0, len(updateDescription.Files))
+	for fileName := range updateDescription.Files {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+	for _, fileName := range fileNames {
+		packager.InfoLog.Printf("Verifying the file %s\n", fileName)
+		serverFileChecksum, err := base64.StdEncoding.DecodeString(updateDescription.Files[fileName])
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("the checksum of the file %s is invalid: %s", fileName, err.Error()))
+			continue
+		}
+		contents, err := packager.downloadVerifiedFile(ctx, httpClient, updateDescription, fileName)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		hasher, err := entities.NewChecksumHasher(checksumFunction)
+		if err != nil {
+			return err
+		}
+		hasher.Write(contents)
+		if !bytes.Equal(hasher.Sum(nil), serverFileChecksum) {
+			problems = append(problems, fmt.Sprintf("the checksum of the file %s doesn't match", fileName))
+		}
+	}
+	for userRole, files := range updateDescription.Roles {
+		for _, fileName := range files {
+			if _, isChecksumFound := updateDescription.Files[fileName]; !isChecksumFound {
+				problems = append(problems,
+					fmt.Sprintf("the file %s of the role %s has no checksum", fileName, userRole))
+			}
+		}
+	}
+	for userRole, executable := range updateDescription.Executables {
+		if _, isChecksumFound := updateDescription.Files[executable]; !isChecksumFound {
+			problems = append(problems,
+				fmt.Sprintf("the executable %s of the role %s has no checksum", executable, userRole))
+		}
+	}
+	for fileName := range updateDescription.Compression {
+		if _, isChecksumFound := updateDescription.Files[fileName]; !isChecksumFound {
+			problems = append(problems, fmt.Sprintf("the compressed file %s has no checksum", fileName))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("found %d problem(s) in the updates folder:\n%s", len(problems), strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+func (packager *Packager) downloadVerifiedFile(ctx context.Context, httpClient *http.Client,
+	updateDescription *entities.UpdateDescription, fileName string) ([]byte, error) {
+	remoteFileName, err := updateDescription.GetRemoteFileName(fileName)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := entities.ReadFileFromUpdateFolder(ctx, httpClient,
+		entities.Settings.ServerUpdateFolder, remoteFileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to download the file %s: %s", remoteFileName, err.Error())
+	}
+	if remoteFileName == fileName {
+		return contents, nil
+	}
+	compressedFileChecksum, err := base64.StdEncoding.DecodeString(updateDescription.CompressedFiles[fileName])
+	if err != nil {
+		return nil, fmt.Errorf("the checksum of the file %s is invalid: %s", remoteFileName, err.Error())
+	}
+	checksumFunction, err := updateDescription.GetChecksumFunction()
+	if err != nil {
+		return nil, err
+	}
+	hasher, err := entities.NewChecksumHasher(checksumFunction)
+	if err != nil {
+		return nil, err
+	}
+	hasher.Write(contents)
+	if !bytes.Equal(hasher.Sum(nil), compressedFileChecksum) {
+		return nil, fmt.Errorf("the checksum of the file %s doesn't match", remoteFileName)
+	}
+	gzipReader, err := gzip.NewReader(bytes.NewReader(contents))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress the file %s: %s", remoteFileName, err.Error())
+	}
+	defer gzipReader.Close()
+	decompressedContents, err := io.ReadAll(gzipReader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress the file %s: %s", remoteFileName, err.Error())
+	}
+	return decompressedContents, nil
+}
@@ -3,12 +3,17 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
 	"os/signal"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -17,14 +22,36 @@ import (
 )
 
 const (
-	serverBufferSize          uint          = 1024
+	serverMaxMessageSize      int64         = 64 * 1024
 	serverFileLogMaxAge       time.Duration = 24 * time.Hour
 	serverFileLogRotationTime time.Duration = time.Hour
+	defaultRequestTimeout     time.Duration = 30 * time.Second
+	idempotencyCacheSize      int           = 1024
+	idempotencyKeyLifetime    time.Duration = 10 * time.Minute
 )
 
+type Options struct {
+	RequestLog       bool
+	MaxSetsPerMinute int
+	HTTPAddress      string
+	ListenAddress    string
+	RequestTimeout   time.Duration
+	Service          bool
+}
+
 type Server struct {
 	Socket           string
-	CurrentState     *entities.StateResponse
+	Options          *Options
+	States           map[string]*entities.StateResponse
+	stateMutex       sync.Mutex
+	sequence         uint64
+	startTime        time.Time
+	totalSets        uint64
+	totalGets        uint64
+	lastChangeTime   time.Time
+	alarmLimiter     *rateLimiter
+	alarmResponses   *idempotencyCache
+	webhookNotifier  *webhookNotifier
 	InfoLog          *log.Logger
 	ErrorLog         *log.Logger
 	FileLog          *rotatelogs.RotateLogs
@@ -33,18 +60,16 @@ type Server struct {
 
 func NewServer() (*Server, error) {
 	server := Server{
-		CurrentState: entities.NewStateResponse(&entities.InitiatorData{
-			Host: "",
-			User: "",
-		}, false),
+		States:           make(map[string]*entities.StateResponse, 1),
+		startTime:        time.Now(),
+		alarmResponses:   newIdempotencyCache(idempotencyCacheSize, idempotencyKeyLifetime, time.Now),
 		InfoLog:          log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime),
 		ErrorLog:         log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile),
 		interruptChannel: make(chan os.Signal, 1),
 	}
 	signal.Notify(server.interruptChannel, os.Interrupt, syscall.SIGTERM)
 	go func() {
-		<-server.interruptChannel
-		server.Stop(1)
+		server.Stop(entities.GetInterruptExitCode(<-server.interruptChannel))
 	}()
 
 	fileLog, err := rotatelogs.New(
@@ -59,53 +84,172 @@ func NewServer() (*Server, error) {
 	server.InfoLog.SetOutput(server.FileLog)
 	server.ErrorLog.SetOutput(server.FileLog)
 
+	err = entities.ReadCommonSettingsFromFile()
+	if err != nil {
+		return &server, err
+	}
 	isUpdaterRunningNow := entities.IsUpdaterRunningNow(server.InfoLog, server.ErrorLog)
 	if isUpdaterRunningNow {
 		return &server, errors.New("the updater is running now")
 	}
-	err = entities.ReadCommonSettingsFromFile()
+	server.Options, err = parseServerOptions()
 	if err != nil {
 		return &server, err
 	}
-	port, err := parseServerArgs()
-	if err != nil {
+	if server.Options.MaxSetsPerMinute > 0 {
+		server.alarmLimiter = newRateLimiter(server.Options.MaxSetsPerMinute, time.Now)
+	}
+	if len(entities.Settings.WebhookURLs) > 0 {
+		server.webhookNotifier, err = newWebhookNotifier(entities.Settings.WebhookURLs, server.InfoLog, server.ErrorLog)
+		if err != nil {
+			return &server, err
+		}
+	}
+	settingsSocket, err := parseServerArgs()
+	if err != nil && server.Options.ListenAddress == "" {
 		return &server, err
 	}
-	server.Socket = "0.0.0.0:" + port
+	server.Socket = entities.ResolveServerAddress(settingsSocket, server.Options.ListenAddress)
 	return &server, nil
 }
 
+func parseServerOptions() (*Options, error) {
+	requestLogPointer := flag.Bool("request-log", true, "log every request with its duration and result")
+	maxSetsPerMinutePointer := flag.Int("max-sets-per-minute", 0,
+		"maximum number of alarm requests per minute from a single initiator (0 means no limit)")
+	httpAddressPointer := flag.String("http-address", "",
+		"address of the read-only HTTP server with the /state and /stats endpoints (for example, 127.0.0.1:8081)")
+	listenAddressPointer := flag.String("listen-address", "",
+		"address to listen on, host:port or unix:///path/to.sock (default is the port of the first server address)")
+	requestTimeoutPointer := flag.Duration("request-timeout", defaultRequestTimeout,
+		"maximum time to read a request and write the response on one connection (0 means no limit)")
+	servicePointer := flag.Bool("service", false,
+		"run as a Windows service, the service control manager stops the server (ignored on other OS)")
+	flag.Parse()
+	if *maxSetsPerMinutePointer < 0 {
+		return nil, errors.New("the maximum number of alarm requests per minute can't be negative")
+	}
+	if *requestTimeoutPointer < 0 {
+		return nil, errors.New("the request timeout can't be negative")
+	}
+	if *listenAddressPointer != "" {
+		err := entities.ValidateServerAddress(*listenAddressPointer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listen address, %s", err.Error())
+		}
+	}
+	return &Options{
+		RequestLog:       *requestLogPointer,
+		MaxSetsPerMinute: *maxSetsPerMinutePointer,
+		HTTPAddress:      *httpAddressPointer,
+		ListenAddress:    *listenAddressPointer,
+		RequestTimeout:   *requestTimeoutPointer,
+		Service:          *servicePointer,
+	}, nil
+}
+
 func parseServerArgs() (string, error) {
-	port := ""
 	if entities.Settings == nil {
-		return port, errors.New("settings are not filled")
+		return "", errors.New("settings are not filled")
 	}
-	resolvedSocket, err := net.ResolveTCPAddr("tcp", entities.Settings.ServerSocket)
+	serverSocket := entities.Settings.GetServerSockets()[0]
+	network, _ := entities.ParseServerAddress(serverSocket)
+	if network == "unix" {
+		return serverSocket, nil
+	}
+	resolvedSocket, err := net.ResolveTCPAddr(network, serverSocket)
 	if err != nil {
-		return port, fmt.Errorf("invalid server address, %s", err.Error())
+		return "", fmt.Errorf("invalid server address, %s", err.Error())
 	}
-	port = strconv.Itoa(resolvedSocket.Port)
-	return port, nil
+	return "0.0.0.0:" + strconv.Itoa(resolvedSocket.Port), nil
+}
+
+func removeStaleUnixSocket(socketPath string) error {
+	fileInfo, err := os.Stat(socketPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fileInfo.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", socketPath)
+	}
+	connection, err := net.Dial("unix", socketPath)
+	if err == nil {
+		connection.Close()
+		return fmt.Errorf("%s is used by another server", socketPath)
+	}
+	return os.Remove(socketPath)
 }
 
 func main() {
+	entities.HandleVersionCommand()
+	entities.HandleDoctorCommand()
+	handleStateCommand()
+	handleConfigCommand()
 	server, err := NewServer()
 	if err != nil {
 		server.ErrorLog.Println("Error when starting the server:", err.Error())
 		server.Stop(1)
 	}
-	server.Run()
+	entities.HandleReloadSignal(server.InfoLog, server.ErrorLog, server.getRestartRequiredChanges)
+	if !server.Options.Service {
+		server.Run()
+		return
+	}
+	err = entities.RunAsService("alarm-server", server.interruptChannel, server.ErrorLog, server.Run)
+	if err != nil {
+		server.ErrorLog.Println("Error when starting the service:", err.Error())
+		server.Stop(1)
+	}
+}
+
+func (server *Server) getRestartRequiredChanges(previous *entities.CommonSettings,
+	current *entities.CommonSettings) []string {
+	warnings := make([]string, 0, 2)
+	if server.Options.ListenAddress == "" &&
+		previous.GetServerSockets()[0] != current.GetServerSockets()[0] {
+		warnings = append(warnings, "the server address was changed, restart the server to listen on it")
+	}
+	if strings.Join(previous.WebhookURLs, "\n") != strings.Join(current.WebhookURLs, "\n") {
+		warnings = append(warnings, "the webhooks were changed, restart the server to apply them")
+	}
+	return warnings
 }
 
 func (server *Server) Run() {
-	listener, err := net.Listen("tcp", server.Socket)
+	listener, err := server.listen()
 	if err != nil {
 		server.ErrorLog.Fatal("Error when starting the server:", err.Error())
 	}
 	defer listener.Close()
 	server.InfoLog.Println("The server is running on", server.Socket)
+	server.InfoLog.Println("Settings:", entities.Settings.String())
+	if server.Options.HTTPAddress != "" {
+		go server.runHTTPServer()
+	}
+	server.serve(listener)
+}
+
+func (server *Server) listen() (net.Listener, error) {
+	network, address := entities.ParseServerAddress(server.Socket)
+	if network == "unix" {
+		err := removeStaleUnixSocket(address)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen(network, address)
+}
+
+// serve accepts the client connections until the listener is closed.
+func (server *Server) serve(listener net.Listener) {
 	for {
 		connection, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
 		if err != nil {
 			server.ErrorLog.Println("Error while waiting for connection:", err.Error())
 			continue
@@ -131,14 +275,33 @@ func (server *Server) Stop(exitCode int) {
 }
 
 func (server *Server) decodeClientRequest(connection net.Conn) {
-	byteBuf := make([]byte, serverBufferSize)
-	bytesRead, err := connection.Read(byteBuf)
+	startTime := time.Now()
+	defer connection.Close()
+	if server.Options.RequestTimeout > 0 {
+		connection.SetDeadline(startTime.Add(server.Options.RequestTimeout))
+	}
+	message := &entities.Message{}
+	err := json.NewDecoder(io.LimitReader(connection, serverMaxMessageSize)).Decode(message)
+	if isTimeoutError(err) {
+		server.ErrorLog.Printf("The request from %s wasn't received within %s, closing the connection\n",
+			connection.RemoteAddr().String(), server.Options.RequestTimeout)
+		return
+	}
 	if err != nil {
 		server.ErrorLog.Println("Error while reading message:", err.Error())
 	}
-	message := &entities.Message{}
-	if err := json.Unmarshal(byteBuf[:bytesRead], &message); err != nil {
-		server.ErrorLog.Println("Error while processing message:", err.Error())
+	requestID := message.RequestID
+	if requestID == "" {
+		requestID = entities.NewRequestID()
+	}
+	var request interface{}
+	if message.Data == nil {
+		err = server.rejectClientRequest(connection, entities.InvalidRequestError, "the request has no data")
+		if server.Options.RequestLog {
+			server.logRequest(message.Type, requestID, getRequestClient(message, message.Metadata),
+				time.Since(startTime), err)
+		}
+		return
 	}
 	switch message.Type {
 	case "AlarmRequest":
@@ -146,43 +309,335 @@ func (server *Server) decodeClientRequest(connection net.Conn) {
 		if err := json.Unmarshal(*message.Data, &alarmRequest); err != nil {
 			server.ErrorLog.Println("Error while processing message:", err.Error())
 		}
-		server.processClientRequest(connection, alarmRequest)
+		alarmRequest.RequestID = requestID
+		request = alarmRequest
 	case "StateRequest":
 		stateRequest := entities.StateRequest{}
 		if err := json.Unmarshal(*message.Data, &stateRequest); err != nil {
 			server.ErrorLog.Println("Error while processing message:", err.Error())
 		}
-		server.processClientRequest(connection, stateRequest)
+		stateRequest.RequestID = requestID
+		request = stateRequest
+	case "ServerInfoRequest":
+		serverInfoRequest := entities.ServerInfoRequest{}
+		if err := json.Unmarshal(*message.Data, &serverInfoRequest); err != nil {
+			server.ErrorLog.Println("Error while processing message:", err.Error())
+		}
+		serverInfoRequest.RequestID = requestID
+		request = serverInfoRequest
+	case "AlarmBatchRequest":
+		alarmBatchRequest := entities.AlarmBatchRequest{}
+		if err := json.Unmarshal(*message.Data, &alarmBatchRequest); err != nil {
+			server.ErrorLog.Println("Error while processing message:", err.Error())
+		}
+		alarmBatchRequest.RequestID = requestID
+		request = alarmBatchRequest
+	case "ResetRequest":
+		resetRequest := entities.ResetRequest{}
+		if err := json.Unmarshal(*message.Data, &resetRequest); err != nil {
+			server.ErrorLog.Println("Error while processing message:", err.Error())
+		}
+		resetRequest.RequestID = requestID
+		request = resetRequest
 	default:
-		server.processClientRequest(connection, message)
+		request = message
+	}
+	err = server.processClientRequest(connection, request)
+	if server.Options.RequestLog {
+		server.logRequest(message.Type, requestID, getRequestClient(request, message.Metadata), time.Since(startTime), err)
+	}
+}
+
+func isTimeoutError(err error) bool {
+	var netError net.Error
+	return errors.As(err, &netError) && netError.Timeout()
+}
+
+func (server *Server) logRequest(requestType string, requestID string, initiator string,
+	duration time.Duration, err error) {
+	if err != nil {
+		server.ErrorLog.Printf("Request %s %s from %s failed in %s: %s\n",
+			requestType, requestID, initiator, duration, err.Error())
+		return
+	}
+	server.InfoLog.Printf("Request %s %s from %s processed in %s\n", requestType, requestID, initiator, duration)
+}
+
+func getRequestClient(request interface{}, metadata map[string]string) string {
+	initiator := getRequestInitiator(request)
+	if len(metadata) == 0 {
+		return initiator
+	}
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fields := make([]string, 0, len(keys))
+	for _, key := range keys {
+		fields = append(fields, fmt.Sprintf("%s=%q", key, metadata[key]))
+	}
+	return fmt.Sprintf("%s (%s)", initiator, strings.Join(fields, ", "))
+}
+
+func getRequestInitiator(request interface{}) string {
+	var initiator *entities.InitiatorData
+	switch request := request.(type) {
+	case entities.AlarmRequest:
+		initiator = request.Initiator
+	case entities.StateRequest:
+		initiator = request.Initiator
+	case entities.ServerInfoRequest:
+		initiator = request.Initiator
+	case entities.ResetRequest:
+		initiator = request.Initiator
+	case entities.AlarmBatchRequest:
+		initiator = request.GetInitiator()
+	}
+	return initiator.String()
+}
+
+func (server *Server) rejectClientRequest(connection net.Conn, code string, message string) error {
+	response, err := entities.NewErrorResponse(code, message).Serialize()
+	if err != nil {
+		server.ErrorLog.Println("Error while forming a response:", err.Error())
+		return err
+	}
+	_, err = connection.Write(response)
+	if err != nil {
+		return err
+	}
+	return errors.New(message)
+}
+
+func (server *Server) getZoneState(zone string) *entities.StateResponse {
+	state, isStateFound := server.States[zone]
+	if !isStateFound {
+		state = entities.NewStateResponse(&entities.InitiatorData{
+			Host: "",
+			User: "",
+		}, false)
+		state.Zone = zone
+	}
+	return state
+}
+
+func isSameAlarmState(currentState *entities.StateResponse, newState *entities.StateResponse) bool {
+	return currentState.Sequence > 0 &&
+		currentState.IsAlarmButtonPressed == newState.IsAlarmButtonPressed &&
+		currentState.GetSeverity() == newState.GetSeverity() &&
+		currentState.Reason == newState.Reason &&
+		currentState.Initiator.Equal(newState.Initiator)
+}
+
+func (server *Server) applyAlarmState(alarmRequest *entities.AlarmRequest,
+	newState *entities.StateResponse) *entities.AlarmResponse {
+	server.totalSets++
+	currentState := server.getZoneState(alarmRequest.Zone)
+	if isSameAlarmState(currentState, newState) {
+		server.InfoLog.Printf("The state of the zone %s is unchanged, sequence: %d\n",
+			entities.GetZoneName(alarmRequest.Zone), currentState.Sequence)
+		return alarmRequest.GetAlarmResponse(currentState.Sequence)
+	}
+	server.sequence++
+	server.lastChangeTime = newState.DateTime
+	newState.Sequence = server.sequence
+	server.States[alarmRequest.Zone] = newState
+	server.emitStateChange(entities.NewStateChange(currentState, newState, alarmRequest.Initiator))
+	server.InfoLog.Println("Current state of the alarm button:", newState.String())
+	return alarmRequest.GetAlarmResponse(server.sequence)
+}
+
+func getIdempotencyCacheKey(request interface{}, idempotencyKey string) string {
+	if idempotencyKey == "" {
+		return ""
+	}
+	return fmt.Sprintf("%T:%s:%s", request, getRequestInitiator(request), idempotencyKey)
+}
+
+func (server *Server) reserveAlarmResponse(connection net.Conn, request interface{},
+	idempotencyKey string) (*idempotencyEntry, bool, error) {
+	response, reservation := server.alarmResponses.Begin(getIdempotencyCacheKey(request, idempotencyKey))
+	if response == nil {
+		return reservation, false, nil
+	}
+	server.InfoLog.Println("The alarm request with the idempotency key", idempotencyKey,
+		"was already applied, sending the original response")
+	_, err := connection.Write(response)
+	return nil, true, err
+}
+
+func (server *Server) emitStateChange(stateChange *entities.StateChange) {
+	if server.webhookNotifier != nil {
+		server.webhookNotifier.Notify(stateChange)
 	}
-	connection.Close()
 }
 
-func (server *Server) processClientRequest(connection net.Conn, request interface{}) {
+func (server *Server) resetStates(initiator *entities.InitiatorData) *entities.ResetResponse {
+	server.stateMutex.Lock()
+	defer server.stateMutex.Unlock()
+	server.sequence++
+	resetResponse := &entities.ResetResponse{
+		DateTime:     time.Now(),
+		ClearedZones: len(server.States),
+		Sequence:     server.sequence,
+	}
+	server.lastChangeTime = resetResponse.DateTime
+	previousStates := server.States
+	server.States = make(map[string]*entities.StateResponse, 1)
+	for zone, previousState := range previousStates {
+		newState := server.getZoneState(zone)
+		newState.DateTime = resetResponse.DateTime
+		newState.Sequence = server.sequence
+		server.emitStateChange(entities.NewStateChange(previousState, newState, initiator))
+	}
+	server.InfoLog.Println("The alarm state was reset:", resetResponse.String())
+	return resetResponse
+}
+
+func (server *Server) processClientRequest(connection net.Conn, request interface{}) error {
 	switch request.(type) {
 	case entities.AlarmRequest:
 		alarmRequest := request.(entities.AlarmRequest)
-		server.InfoLog.Println("Alarm alert received:", alarmRequest.String())
-		server.CurrentState = alarmRequest.GetStateResponse()
-		server.InfoLog.Println("Current state of the alarm button:", server.CurrentState.String())
-		response, err := alarmRequest.GetAlarmResponse().Serialize()
+		server.InfoLog.Printf("Alarm alert received, request ID: %s, %s\n", alarmRequest.RequestID, alarmRequest.String())
+		if !alarmRequest.IsAuthorized(entities.CurrentSettings().AuthToken) {
+			return server.rejectClientRequest(connection, entities.UnauthenticatedError,
+				"the authentication token is missing or invalid")
+		}
+		if len(alarmRequest.IdempotencyKey) > entities.MaxIdempotencyKeyLength {
+			return server.rejectClientRequest(connection, entities.InvalidRequestError,
+				fmt.Sprintf("the idempotency key is longer than %d characters", entities.MaxIdempotencyKeyLength))
+		}
+		reservation, isRepeated, err := server.reserveAlarmResponse(connection, alarmRequest,
+			alarmRequest.IdempotencyKey)
+		if isRepeated {
+			return err
+		}
+		defer server.alarmResponses.Abandon(reservation)
+		if server.alarmLimiter != nil && !server.alarmLimiter.Allow(getRequestInitiator(alarmRequest)) {
+			return server.rejectClientRequest(connection, entities.RateLimitedError,
+				"too many alarm requests, try again later")
+		}
+		server.stateMutex.Lock()
+		newState := alarmRequest.GetStateResponse(server.sequence + 1)
+		err = newState.Validate()
+		if err != nil {
+			server.stateMutex.Unlock()
+			return server.rejectClientRequest(connection, entities.InvalidRequestError, err.Error())
+		}
+		response, err := server.applyAlarmState(&alarmRequest, newState).Serialize()
+		if err == nil {
+			server.alarmResponses.Complete(reservation, response)
+		}
+		server.stateMutex.Unlock()
 		if err != nil {
 			server.ErrorLog.Println("Error while forming a response:", err.Error())
-		} else {
-			connection.Write(response)
+			return err
+		}
+		_, err = connection.Write(response)
+		return err
+	case entities.AlarmBatchRequest:
+		alarmBatchRequest := request.(entities.AlarmBatchRequest)
+		server.InfoLog.Printf("Alarm batch received, request ID: %s, %s\n",
+			alarmBatchRequest.RequestID, alarmBatchRequest.String())
+		if !alarmBatchRequest.IsAuthorized(entities.CurrentSettings().AuthToken) {
+			return server.rejectClientRequest(connection, entities.UnauthenticatedError,
+				"the authentication token is missing or invalid")
+		}
+		if len(alarmBatchRequest.IdempotencyKey) > entities.MaxIdempotencyKeyLength {
+			return server.rejectClientRequest(connection, entities.InvalidRequestError,
+				fmt.Sprintf("the idempotency key is longer than %d characters", entities.MaxIdempotencyKeyLength))
+		}
+		reservation, isRepeated, err := server.reserveAlarmResponse(connection, alarmBatchRequest,
+			alarmBatchRequest.IdempotencyKey)
+		if isRepeated {
+			return err
+		}
+		defer server.alarmResponses.Abandon(reservation)
+		if server.alarmLimiter != nil && !server.alarmLimiter.Allow(getRequestInitiator(alarmBatchRequest)) {
+			return server.rejectClientRequest(connection, entities.RateLimitedError,
+				"too many alarm requests, try again later")
+		}
+		err = alarmBatchRequest.Validate()
+		if err != nil {
+			return server.rejectClientRequest(connection, entities.InvalidRequestError, err.Error())
 		}
+		server.stateMutex.Lock()
+		newStates := make([]*entities.StateResponse, 0, len(alarmBatchRequest.Requests))
+		for _, alarmRequest := range alarmBatchRequest.Requests {
+			newState := alarmRequest.GetStateResponse(0)
+			err = newState.Validate()
+			if err != nil {
+				server.stateMutex.Unlock()
+				return server.rejectClientRequest(connection, entities.InvalidRequestError,
+					fmt.Sprintf("zone %s: %s", entities.GetZoneName(alarmRequest.Zone), err.Error()))
+			}
+			newStates = append(newStates, newState)
+		}
+		alarmBatchResponse := &entities.AlarmBatchResponse{
+			Responses: make([]*entities.AlarmResponse, 0, len(newStates)),
+		}
+		for i, alarmRequest := range alarmBatchRequest.Requests {
+			alarmBatchResponse.Responses = append(alarmBatchResponse.Responses,
+				server.applyAlarmState(alarmRequest, newStates[i]))
+		}
+		response, err := alarmBatchResponse.Serialize()
+		if err == nil {
+			server.alarmResponses.Complete(reservation, response)
+		}
+		server.stateMutex.Unlock()
+		if err != nil {
+			server.ErrorLog.Println("Error while forming a response:", err.Error())
+			return err
+		}
+		_, err = connection.Write(response)
+		return err
 	case entities.StateRequest:
 		stateRequest := request.(entities.StateRequest)
-		server.InfoLog.Println("Status check request received:", stateRequest.String())
-		response, err := server.CurrentState.Serialize()
+		server.InfoLog.Printf("Status check request received, request ID: %s, %s\n",
+			stateRequest.RequestID, stateRequest.String())
+		server.stateMutex.Lock()
+		server.totalGets++
+		currentState := server.getZoneState(stateRequest.Zone).Clone()
+		server.stateMutex.Unlock()
+		response, err := currentState.Serialize()
+		if err != nil {
+			server.ErrorLog.Println("Error while forming a response:", err.Error())
+			return err
+		}
+		_, err = connection.Write(response)
+		if err != nil {
+			return err
+		}
+		server.InfoLog.Println("Status sent to client:", currentState.String())
+		return nil
+	case entities.ServerInfoRequest:
+		serverInfoRequest := request.(entities.ServerInfoRequest)
+		server.InfoLog.Printf("Server information request received, request ID: %s, %s\n",
+			serverInfoRequest.RequestID, serverInfoRequest.String())
+		response, err := entities.NewServerInfoResponse().Serialize()
+		if err != nil {
+			server.ErrorLog.Println("Error while forming a response:", err.Error())
+			return err
+		}
+		_, err = connection.Write(response)
+		return err
+	case entities.ResetRequest:
+		resetRequest := request.(entities.ResetRequest)
+		server.InfoLog.Printf("Reset request received, request ID: %s, %s\n", resetRequest.RequestID, resetRequest.String())
+		if !resetRequest.IsAuthorized(entities.CurrentSettings().AuthToken) {
+			return server.rejectClientRequest(connection, entities.UnauthenticatedError,
+				"the authentication token is missing or invalid")
+		}
+		resetResponse, err := server.resetStates(resetRequest.Initiator).Serialize()
 		if err != nil {
 			server.ErrorLog.Println("Error while forming a response:", err.Error())
-		} else {
-			connection.Write(response)
-			server.InfoLog.Println("Status sent to client:", server.CurrentState.String())
+			return err
 		}
+		_, err = connection.Write(resetResponse)
+		return err
 	default:
 		server.InfoLog.Println("Other information received:", request)
+		return nil
 	}
 }
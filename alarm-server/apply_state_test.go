@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/oshokin/alarm-button/entities"
+)
+
+func TestApplyAlarmStateSkipsUnchangedState(t *testing.T) {
+	server := newTestServer()
+	initiator := &entities.InitiatorData{Host: "host", User: "user"}
+	alarmRequest := &entities.AlarmRequest{Initiator: initiator, IsAlarmButtonPressed: true}
+	server.applyAlarmState(alarmRequest, entities.NewStateResponse(initiator.Clone(), true))
+	firstState := server.States[""]
+	server.applyAlarmState(alarmRequest, entities.NewStateResponse(initiator.Clone(), true))
+	if server.sequence != 1 || server.States[""] != firstState {
+		t.Fatalf("expected the unchanged state to be kept, sequence: %d", server.sequence)
+	}
+	otherInitiator := &entities.InitiatorData{Host: "host", User: "other"}
+	server.applyAlarmState(&entities.AlarmRequest{Initiator: otherInitiator, IsAlarmButtonPressed: true},
+		entities.NewStateResponse(otherInitiator, true))
+	if server.sequence != 2 || !server.States[""].Initiator.Equal(otherInitiator) {
+		t.Fatalf("expected a state from another initiator to be applied, sequence: %d", server.sequence)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/oshokin/alarm-button/entities"
+)
+
+func TestServerRejectsRequestsWithoutValidToken(t *testing.T) {
+	entities.Settings = &entities.CommonSettings{AuthToken: "secret"}
+	defer func() {
+		entities.Settings = &entities.CommonSettings{}
+	}()
+	messages := []string{
+		`{"type":"AlarmRequest","data":{"initiator":{"host":"host","user":"user"},"isAlarmButtonPressed":true}}`,
+		`{"type":"AlarmRequest","data":{"initiator":{"host":"host","user":"user"},"isAlarmButtonPressed":true,` +
+			`"token":"wrong"}}`,
+		`{"type":"ResetRequest","data":{"initiator":{"host":"host","user":"user"}}}`,
+		`{"type":"ResetRequest","data":{"initiator":{"host":"host","user":"user"},"token":"wrong"}}`,
+	}
+	for _, message := range messages {
+		server := newTestServer()
+		initiator := &entities.InitiatorData{Host: "host", User: "other"}
+		server.States[""] = entities.NewStateResponse(initiator, true)
+		response := sendTestMessage(t, server, message)
+		data, _ := response["data"].(map[string]interface{})
+		if response["type"] != "ErrorResponse" || data["code"] != entities.UnauthenticatedError {
+			t.Errorf("expected %s to be rejected as unauthenticated, got %v", message, response)
+		}
+		state, isStateFound := server.States[""]
+		if !isStateFound || !state.IsAlarmButtonPressed || !state.Initiator.Equal(initiator) || server.sequence != 0 {
+			t.Errorf("expected %s to leave the state unchanged", message)
+		}
+	}
+}
+
+func TestServerAcceptsRequestWithValidToken(t *testing.T) {
+	entities.Settings = &entities.CommonSettings{AuthToken: "secret"}
+	defer func() {
+		entities.Settings = &entities.CommonSettings{}
+	}()
+	server := newTestServer()
+	message := `{"type":"AlarmRequest","data":{"initiator":{"host":"host","user":"user"},` +
+		`"isAlarmButtonPressed":true,"token":"secret"}}`
+	response := sendTestMessage(t, server, message)
+	if response["type"] == "ErrorResponse" {
+		t.Fatalf("expected the request with a valid token to be accepted, got %v", response)
+	}
+	state, isStateFound := server.States[""]
+	if !isStateFound || !state.IsAlarmButtonPressed || server.sequence != 1 {
+		t.Fatal("expected the alarm state to be applied")
+	}
+}
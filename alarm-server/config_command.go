@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oshokin/alarm-button/entities"
+)
+
+const (
+	minRecommendedHTTPTimeout time.Duration = 5 * time.Second
+	minRecommendedDialTimeout time.Duration = 1 * time.Second
+)
+
+func handleConfigCommand() {
+	if len(os.Args) < 2 || os.Args[1] != "config" {
+		return
+	}
+	if len(os.Args) < 3 || os.Args[2] != "validate" {
+		fmt.Fprintln(os.Stderr, "Usage: alarm-server config validate [-config path]")
+		os.Exit(2)
+	}
+	validateFlags := flag.NewFlagSet("config validate", flag.ExitOnError)
+	settingsFileNamePointer := validateFlags.String("config", entities.GetSettingsFileName(),
+		"path to the settings file, - reads it from the standard input")
+	validateFlags.Parse(os.Args[3:])
+	err := validateConfig(*settingsFileNamePointer, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid:", err.Error())
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func validateConfig(settingsFileName string, output io.Writer) error {
+	err := entities.ReadCommonSettingsFromPath(settingsFileName)
+	if err != nil {
+		return err
+	}
+	for _, warning := range getConfigWarnings(entities.Settings) {
+		fmt.Fprintln(output, "WARNING:", warning)
+	}
+	fmt.Fprintln(output, "valid:", entities.Settings.String())
+	return nil
+}
+
+func getConfigWarnings(settings *entities.CommonSettings) []string {
+	warnings := make([]string, 0, 4)
+	if isPlainHTTP(settings.ServerUpdateFolder) {
+		warnings = append(warnings, "the updates folder uses http:// without TLS")
+	}
+	for _, webhookURL := range settings.WebhookURLs {
+		if isPlainHTTP(webhookURL) {
+			warnings = append(warnings, "a webhook uses http:// without TLS")
+			break
+		}
+	}
+	if settings.InsecureSkipTLSVerify {
+		warnings = append(warnings, "TLS certificate verification is disabled")
+	}
+	if settings.HTTPTimeout < minRecommendedHTTPTimeout {
+		warnings = append(warnings, fmt.Sprintf("the HTTP timeout %s is shorter than %s",
+			settings.HTTPTimeout, minRecommendedHTTPTimeout))
+	}
+	if settings.DialTimeout > 0 && settings.DialTimeout < minRecommendedDialTimeout {
+		warnings = append(warnings, fmt.Sprintf("the dial timeout %s is shorter than %s",
+			settings.DialTimeout, minRecommendedDialTimeout))
+	}
+	return warnings
+}
+
+func isPlainHTTP(rawURL string) bool {
+	parsedURL, err := url.Parse(rawURL)
+	return err == nil && strings.EqualFold(parsedURL.Scheme, "http")
+}
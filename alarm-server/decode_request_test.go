@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/oshokin/alarm-button/entities"
+)
+
+func newTestServer() *Server {
+	return &Server{
+		Options:        &Options{RequestLog: true},
+		States:         make(map[string]*entities.StateResponse, 1),
+		alarmResponses: newIdempotencyCache(16, time.Minute, newTestClock().Now),
+		InfoLog:        log.New(ioutil.Discard, "", 0),
+		ErrorLog:       log.New(ioutil.Discard, "", 0),
+	}
+}
+
+func sendTestMessage(t *testing.T, server *Server, message string) map[string]interface{} {
+	serverConnection, clientConnection := net.Pipe()
+	go server.decodeClientRequest(serverConnection)
+	go func() {
+		clientConnection.Write([]byte(message))
+	}()
+	data, err := io.ReadAll(clientConnection)
+	if err != nil {
+		t.Fatalf("unable to read the response: %s", err.Error())
+	}
+	response := make(map[string]interface{})
+	err = json.Unmarshal(data, &response)
+	if err != nil {
+		t.Fatalf("unable to decode the response %q: %s", data, err.Error())
+	}
+	return response
+}
+
+func TestDecodeClientRequestRejectsMissingData(t *testing.T) {
+	entities.Settings = &entities.CommonSettings{}
+	messages := []string{
+		`{"type":"AlarmRequest"}`,
+		`{"type":"AlarmRequest","data":null}`,
+		`{"type":"AlarmBatchRequest"}`,
+		`{"type":"StateRequest","data":null}`,
+		`{"type":"ResetRequest"}`,
+		`{"type":"ServerInfoRequest"}`,
+	}
+	for _, message := range messages {
+		response := sendTestMessage(t, newTestServer(), message)
+		data, _ := response["data"].(map[string]interface{})
+		if response["type"] != "ErrorResponse" || data["code"] != entities.InvalidRequestError {
+			t.Errorf("expected %s to be rejected as an invalid request, got %v", message, response)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func (server *Server) runHTTPServer() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/state", server.handleStateRequest)
+	mux.HandleFunc("/stats", server.handleStatsRequest)
+	server.InfoLog.Println("The HTTP server is running on", server.Options.HTTPAddress)
+	err := http.ListenAndServe(server.Options.HTTPAddress, mux)
+	if err != nil {
+		server.ErrorLog.Println("Error while running the HTTP server:", err.Error())
+	}
+}
+
+func (server *Server) handleStateRequest(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.Header().Set("Allow", http.MethodGet)
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	server.stateMutex.Lock()
+	server.totalGets++
+	currentState := server.getZoneState(request.URL.Query().Get("zone")).Clone()
+	server.stateMutex.Unlock()
+	server.writeJSON(writer, currentState)
+}
+
+func (server *Server) handleStatsRequest(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.Header().Set("Allow", http.MethodGet)
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	server.writeJSON(writer, server.Stats())
+}
+
+func (server *Server) writeJSON(writer http.ResponseWriter, value interface{}) {
+	contents, err := json.Marshal(value)
+	if err != nil {
+		server.ErrorLog.Println("Error while forming a response:", err.Error())
+		http.Error(writer, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(contents)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type idempotencyCache struct {
+	capacity     int
+	lifetime     time.Duration
+	now          func() time.Time
+	entries      map[string]*list.Element
+	recentKeys   *list.List
+	entriesMutex sync.Mutex
+}
+
+type idempotencyEntry struct {
+	key          string
+	response     []byte
+	creationTime time.Time
+	isPending    bool
+	doneChannel  chan struct{}
+}
+
+func newIdempotencyCache(capacity int, lifetime time.Duration, now func() time.Time) *idempotencyCache {
+	return &idempotencyCache{
+		capacity:   capacity,
+		lifetime:   lifetime,
+		now:        now,
+		entries:    make(map[string]*list.Element, capacity),
+		recentKeys: list.New(),
+	}
+}
+
+// Begin returns the response stored for the key. If there is none, the key is
+// reserved for the caller, who must pass the reservation to Complete or Abandon.
+// Concurrent callers with the same key wait until the reservation is released.
+func (cache *idempotencyCache) Begin(key string) ([]byte, *idempotencyEntry) {
+	if key == "" {
+		return nil, nil
+	}
+	for {
+		cache.entriesMutex.Lock()
+		element, isElementFound := cache.entries[key]
+		if !isElementFound {
+			reservation := &idempotencyEntry{
+				key:         key,
+				isPending:   true,
+				doneChannel: make(chan struct{}),
+			}
+			cache.entries[key] = cache.recentKeys.PushFront(reservation)
+			cache.evictOldEntries()
+			cache.entriesMutex.Unlock()
+			return nil, reservation
+		}
+		entry := element.Value.(*idempotencyEntry)
+		if entry.isPending {
+			cache.entriesMutex.Unlock()
+			<-entry.doneChannel
+			continue
+		}
+		if cache.now().Sub(entry.creationTime) >= cache.lifetime {
+			cache.recentKeys.Remove(element)
+			delete(cache.entries, key)
+			cache.entriesMutex.Unlock()
+			continue
+		}
+		cache.recentKeys.MoveToFront(element)
+		cache.entriesMutex.Unlock()
+		return entry.response, nil
+	}
+}
+
+func (cache *idempotencyCache) Complete(reservation *idempotencyEntry, response []byte) {
+	if reservation == nil {
+		return
+	}
+	cache.entriesMutex.Lock()
+	defer cache.entriesMutex.Unlock()
+	if !reservation.isPending {
+		return
+	}
+	reservation.response = response
+	reservation.creationTime = cache.now()
+	reservation.isPending = false
+	close(reservation.doneChannel)
+	cache.evictOldEntries()
+}
+
+// Abandon releases a reservation that wasn't completed, so the next caller
+// with the same key applies the request. Completed reservations are kept.
+func (cache *idempotencyCache) Abandon(reservation *idempotencyEntry) {
+	if reservation == nil {
+		return
+	}
+	cache.entriesMutex.Lock()
+	defer cache.entriesMutex.Unlock()
+	if !reservation.isPending {
+		return
+	}
+	element, isElementFound := cache.entries[reservation.key]
+	if isElementFound && element.Value == reservation {
+		cache.recentKeys.Remove(element)
+		delete(cache.entries, reservation.key)
+	}
+	reservation.isPending = false
+	close(reservation.doneChannel)
+}
+
+func (cache *idempotencyCache) evictOldEntries() {
+	element := cache.recentKeys.Back()
+	for cache.recentKeys.Len() > cache.capacity && element != nil {
+		previousElement := element.Prev()
+		entry := element.Value.(*idempotencyEntry)
+		if !entry.isPending {
+			cache.recentKeys.Remove(element)
+			delete(cache.entries, entry.key)
+		}
+		element = previousElement
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oshokin/alarm-button/entities"
+)
+
+type testClock struct {
+	currentTime time.Time
+	clockMutex  sync.Mutex
+}
+
+func newTestClock() *testClock {
+	return &testClock{currentTime: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (clock *testClock) Now() time.Time {
+	clock.clockMutex.Lock()
+	defer clock.clockMutex.Unlock()
+	return clock.currentTime
+}
+
+func (clock *testClock) Advance(duration time.Duration) {
+	clock.clockMutex.Lock()
+	defer clock.clockMutex.Unlock()
+	clock.currentTime = clock.currentTime.Add(duration)
+}
+
+func TestIdempotencyCacheReturnsOriginalResponse(t *testing.T) {
+	cache := newIdempotencyCache(16, time.Minute, newTestClock().Now)
+	response, reservation := cache.Begin("key")
+	if response != nil || reservation == nil {
+		t.Fatalf("expected a reservation for a new key, got response %q", response)
+	}
+	cache.Complete(reservation, []byte("original"))
+	response, reservation = cache.Begin("key")
+	if string(response) != "original" || reservation != nil {
+		t.Fatalf("expected the original response, got %q", response)
+	}
+}
+
+func TestIdempotencyCacheExpiresKeys(t *testing.T) {
+	clock := newTestClock()
+	cache := newIdempotencyCache(16, time.Minute, clock.Now)
+	_, reservation := cache.Begin("key")
+	cache.Complete(reservation, []byte("original"))
+	clock.Advance(59 * time.Second)
+	response, _ := cache.Begin("key")
+	if string(response) != "original" {
+		t.Fatalf("expected the original response before the key expires, got %q", response)
+	}
+	clock.Advance(time.Second)
+	response, reservation = cache.Begin("key")
+	if response != nil || reservation == nil {
+		t.Fatalf("expected the key to expire, got response %q", response)
+	}
+}
+
+func TestIdempotencyCacheEvictsLeastRecentlyUsedKeys(t *testing.T) {
+	cache := newIdempotencyCache(2, time.Minute, newTestClock().Now)
+	for _, key := range []string{"first", "second"} {
+		_, reservation := cache.Begin(key)
+		cache.Complete(reservation, []byte(key))
+	}
+	cache.Begin("first")
+	_, reservation := cache.Begin("third")
+	cache.Complete(reservation, []byte("third"))
+	if response, _ := cache.Begin("first"); string(response) != "first" {
+		t.Fatalf("expected the recently used key to stay, got %q", response)
+	}
+	response, reservation := cache.Begin("second")
+	if response != nil {
+		t.Fatalf("expected the least recently used key to be evicted, got %q", response)
+	}
+	cache.Abandon(reservation)
+}
+
+func TestIdempotencyCacheAbandonReleasesKey(t *testing.T) {
+	cache := newIdempotencyCache(16, time.Minute, newTestClock().Now)
+	_, reservation := cache.Begin("key")
+	cache.Abandon(reservation)
+	response, reservation := cache.Begin("key")
+	if response != nil || reservation == nil {
+		t.Fatalf("expected an abandoned key to be reserved again, got response %q", response)
+	}
+	cache.Complete(reservation, []byte("original"))
+	cache.Abandon(reservation)
+	if response, _ := cache.Begin("key"); string(response) != "original" {
+		t.Fatalf("expected abandoning a completed reservation to keep the response, got %q", response)
+	}
+}
+
+func TestIdempotencyCacheWaitsForPendingKey(t *testing.T) {
+	cache := newIdempotencyCache(16, time.Minute, newTestClock().Now)
+	_, reservation := cache.Begin("key")
+	responseChannel := make(chan []byte)
+	go func() {
+		response, _ := cache.Begin("key")
+		responseChannel <- response
+	}()
+	select {
+	case response := <-responseChannel:
+		t.Fatalf("expected the second caller to wait, got %q", response)
+	case <-time.After(50 * time.Millisecond):
+	}
+	cache.Complete(reservation, []byte("original"))
+	if response := <-responseChannel; string(response) != "original" {
+		t.Fatalf("expected the waiting caller to get the original response, got %q", response)
+	}
+}
+
+func TestIdempotencyCacheKeyIsScopedByTypeAndInitiator(t *testing.T) {
+	initiator := &entities.InitiatorData{Host: "host", User: "user"}
+	otherInitiator := &entities.InitiatorData{Host: "host", User: "other"}
+	alarmRequest := entities.AlarmRequest{Initiator: initiator}
+	alarmBatchRequest := entities.AlarmBatchRequest{Requests: []*entities.AlarmRequest{&alarmRequest}}
+	otherAlarmRequest := entities.AlarmRequest{Initiator: otherInitiator}
+	cacheKeys := map[string]bool{
+		getIdempotencyCacheKey(alarmRequest, "key"):      true,
+		getIdempotencyCacheKey(alarmBatchRequest, "key"): true,
+		getIdempotencyCacheKey(otherAlarmRequest, "key"): true,
+	}
+	if len(cacheKeys) != 3 {
+		t.Fatalf("expected distinct cache keys, got %v", cacheKeys)
+	}
+	if cacheKey := getIdempotencyCacheKey(alarmRequest, ""); cacheKey != "" {
+		t.Fatalf("expected no cache key without an idempotency key, got %q", cacheKey)
+	}
+}
+
+func TestServerAppliesConcurrentDuplicateAlarmRequestOnce(t *testing.T) {
+	entities.Settings = &entities.CommonSettings{}
+	server := newTestServer()
+	alarmRequest := entities.AlarmRequest{
+		Initiator:            &entities.InitiatorData{Host: "host", User: "user"},
+		IsAlarmButtonPressed: true,
+		IdempotencyKey:       "key",
+	}
+	const requestCount = 8
+	var requests sync.WaitGroup
+	responses := make([]string, requestCount)
+	for i := 0; i < requestCount; i++ {
+		requests.Add(1)
+		go func(i int) {
+			defer requests.Done()
+			serverConnection, clientConnection := net.Pipe()
+			go func() {
+				defer serverConnection.Close()
+				server.processClientRequest(serverConnection, alarmRequest)
+			}()
+			response, err := io.ReadAll(clientConnection)
+			if err != nil {
+				t.Errorf("unable to read the response: %s", err.Error())
+			}
+			responses[i] = string(response)
+		}(i)
+	}
+	requests.Wait()
+	if server.totalSets != 1 {
+		t.Fatalf("expected the alarm request to be applied once, applied %d times", server.totalSets)
+	}
+	for _, response := range responses[1:] {
+		if response != responses[0] {
+			t.Fatalf("expected identical responses, got %q and %q", responses[0], response)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+type rateLimiter struct {
+	capacity     float64
+	refillPeriod time.Duration
+	now          func() time.Time
+	buckets      map[string]*tokenBucket
+	bucketsMutex sync.Mutex
+	lastSweep    time.Time
+}
+
+type tokenBucket struct {
+	tokens         float64
+	lastRefillTime time.Time
+}
+
+func newRateLimiter(eventsPerMinute int, now func() time.Time) *rateLimiter {
+	return &rateLimiter{
+		capacity:     float64(eventsPerMinute),
+		refillPeriod: time.Minute,
+		now:          now,
+		buckets:      make(map[string]*tokenBucket, 16),
+		lastSweep:    now(),
+	}
+}
+
+func (limiter *rateLimiter) Allow(key string) bool {
+	limiter.bucketsMutex.Lock()
+	defer limiter.bucketsMutex.Unlock()
+	currentTime := limiter.now()
+	limiter.removeIdleBuckets(currentTime)
+	bucket, isBucketFound := limiter.buckets[key]
+	if !isBucketFound {
+		bucket = &tokenBucket{tokens: limiter.capacity, lastRefillTime: currentTime}
+		limiter.buckets[key] = bucket
+	}
+	elapsedTime := currentTime.Sub(bucket.lastRefillTime)
+	if elapsedTime > 0 {
+		bucket.tokens += limiter.capacity * float64(elapsedTime) / float64(limiter.refillPeriod)
+		if bucket.tokens > limiter.capacity {
+			bucket.tokens = limiter.capacity
+		}
+		bucket.lastRefillTime = currentTime
+	}
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// removeIdleBuckets drops the buckets that weren't used for a whole refill period.
+// Such buckets are full again, so dropping them doesn't change any limit, and
+// initiators that stopped sending requests don't take memory forever.
+func (limiter *rateLimiter) removeIdleBuckets(currentTime time.Time) {
+	if currentTime.Sub(limiter.lastSweep) < limiter.refillPeriod {
+		return
+	}
+	limiter.lastSweep = currentTime
+	for key, bucket := range limiter.buckets {
+		if currentTime.Sub(bucket.lastRefillTime) >= limiter.refillPeriod {
+			delete(limiter.buckets, key)
+		}
+	}
+}
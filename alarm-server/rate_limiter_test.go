@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterLimitsInitiator(t *testing.T) {
+	clock := newTestClock()
+	limiter := newRateLimiter(2, clock.Now)
+	if !limiter.Allow("initiator") || !limiter.Allow("initiator") {
+		t.Fatal("expected the first two requests to be allowed")
+	}
+	if limiter.Allow("initiator") {
+		t.Fatal("expected the third request to be limited")
+	}
+	if !limiter.Allow("other") {
+		t.Fatal("expected another initiator to have its own limit")
+	}
+	clock.Advance(30 * time.Second)
+	if !limiter.Allow("initiator") {
+		t.Fatal("expected a token to be refilled after half a minute")
+	}
+}
+
+func TestRateLimiterRemovesIdleBuckets(t *testing.T) {
+	clock := newTestClock()
+	limiter := newRateLimiter(1, clock.Now)
+	for i := 0; i < 100; i++ {
+		limiter.Allow(fmt.Sprintf("initiator-%d", i))
+	}
+	if len(limiter.buckets) != 100 {
+		t.Fatalf("expected 100 buckets, got %d", len(limiter.buckets))
+	}
+	clock.Advance(30 * time.Second)
+	limiter.Allow("initiator-0")
+	clock.Advance(30 * time.Second)
+	limiter.Allow("active")
+	if len(limiter.buckets) != 2 {
+		t.Fatalf("expected only the recently used buckets to stay, got %d", len(limiter.buckets))
+	}
+	if _, isBucketFound := limiter.buckets["initiator-0"]; !isBucketFound {
+		t.Fatal("expected the bucket used half a minute ago to stay")
+	}
+}
+
+func TestRateLimiterKeepsLimitAfterSweep(t *testing.T) {
+	clock := newTestClock()
+	limiter := newRateLimiter(1, clock.Now)
+	limiter.Allow("initiator")
+	clock.Advance(59 * time.Second)
+	limiter.Allow("other")
+	clock.Advance(time.Second)
+	limiter.Allow("other")
+	if len(limiter.buckets) != 1 {
+		t.Fatalf("expected the idle bucket to be removed, got %d buckets", len(limiter.buckets))
+	}
+	if !limiter.Allow("initiator") {
+		t.Fatal("expected the removed bucket to start full")
+	}
+	if limiter.Allow("initiator") {
+		t.Fatal("expected the new bucket to enforce the limit")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/oshokin/alarm-button/entities"
+)
+
+func handleStateCommand() {
+	if len(os.Args) < 2 || os.Args[1] != "state" {
+		return
+	}
+	if len(os.Args) < 3 || os.Args[2] != "reset" {
+		fmt.Fprintln(os.Stderr, "Usage: alarm-server state reset [-yes]")
+		os.Exit(2)
+	}
+	resetFlags := flag.NewFlagSet("state reset", flag.ExitOnError)
+	isConfirmedPointer := resetFlags.Bool("yes", false, "reset the state without asking for confirmation")
+	resetFlags.Parse(os.Args[3:])
+	err := resetAlarmState(*isConfirmedPointer, os.Stdin, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error while resetting the alarm state:", err.Error())
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func resetAlarmState(isConfirmed bool, input io.Reader, output io.Writer) error {
+	err := entities.ReadCommonSettingsFromFile()
+	if err != nil {
+		return err
+	}
+	if !isConfirmed {
+		fmt.Fprint(output, "Release the alarm button in all zones of the running server? [y/N] ")
+		answer, _ := bufio.NewReader(input).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			return errors.New("the reset was cancelled")
+		}
+	}
+	initiator, err := entities.NewInitiatorData()
+	if err != nil {
+		return err
+	}
+	request, err := entities.NewResetRequest(initiator).Serialize()
+	if err != nil {
+		return err
+	}
+	message, err := entities.ExchangeFromSettings(context.Background(), entities.Settings, request)
+	if err != nil {
+		return err
+	}
+	resetResponse := &entities.ResetResponse{}
+	err = entities.UnmarshalServerReply(message, "ResetResponse", resetResponse)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(output, "The alarm state was reset:", resetResponse.String())
+	return nil
+}
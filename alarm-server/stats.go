@@ -0,0 +1,29 @@
+package main
+
+import (
+	"time"
+)
+
+type Stats struct {
+	StartTime      time.Time  `json:"startTime"`
+	Uptime         string     `json:"uptime"`
+	TotalSets      uint64     `json:"totalSets"`
+	TotalGets      uint64     `json:"totalGets"`
+	LastChangeTime *time.Time `json:"lastChangeTime,omitempty"`
+}
+
+func (server *Server) Stats() *Stats {
+	server.stateMutex.Lock()
+	defer server.stateMutex.Unlock()
+	stats := &Stats{
+		StartTime: server.startTime,
+		Uptime:    time.Since(server.startTime).Round(time.Second).String(),
+		TotalSets: server.totalSets,
+		TotalGets: server.totalGets,
+	}
+	if !server.lastChangeTime.IsZero() {
+		lastChangeTime := server.lastChangeTime
+		stats.LastChangeTime = &lastChangeTime
+	}
+	return stats
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/oshokin/alarm-button/entities"
+)
+
+func TestServerAnswersOverUnixSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are not used on Windows")
+	}
+	entities.Settings = &entities.CommonSettings{RequestTimeout: 5 * time.Second}
+	defer func() {
+		entities.Settings = &entities.CommonSettings{}
+	}()
+	server := newTestServer()
+	server.Socket = entities.UnixSocketPrefix + filepath.Join(t.TempDir(), "alarm.sock")
+	initiator := &entities.InitiatorData{Host: "host", User: "user"}
+	server.States[""] = entities.NewStateResponse(initiator, true)
+	listener, err := server.listen()
+	if err != nil {
+		t.Fatalf("unable to listen on %s: %s", server.Socket, err.Error())
+	}
+	defer listener.Close()
+	go server.serve(listener)
+	request, err := (&entities.StateRequest{Initiator: initiator, RequestID: entities.NewRequestID()}).Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := entities.ExchangeWithServer(server.Socket, request)
+	if err != nil {
+		t.Fatalf("unable to exchange with the server: %s", err.Error())
+	}
+	stateResponse := &entities.StateResponse{}
+	err = entities.UnmarshalServerReply(message, "StateResponse", stateResponse)
+	if err != nil {
+		t.Fatalf("unable to decode the reply: %s", err.Error())
+	}
+	if !stateResponse.IsAlarmButtonPressed || !stateResponse.Initiator.Equal(initiator) {
+		t.Fatalf("unexpected state %s", stateResponse.String())
+	}
+}
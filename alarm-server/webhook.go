@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/oshokin/alarm-button/entities"
+)
+
+const (
+	webhookQueueSize     int           = 64
+	webhookTimeout       time.Duration = 10 * time.Second
+	webhookRetries       int           = 3
+	webhookRetryInterval time.Duration = 1 * time.Second
+)
+
+type webhookNotifier struct {
+	URLs       []string
+	httpClient *http.Client
+	queues     []chan []byte
+	InfoLog    *log.Logger
+	ErrorLog   *log.Logger
+}
+
+func newWebhookNotifier(urls []string, infoLog *log.Logger, errorLog *log.Logger) (*webhookNotifier, error) {
+	httpClient, err := entities.NewHTTPClient(entities.Settings)
+	if err != nil {
+		return nil, err
+	}
+	notifier := &webhookNotifier{
+		URLs:       urls,
+		httpClient: httpClient,
+		queues:     make([]chan []byte, len(urls)),
+		InfoLog:    infoLog,
+		ErrorLog:   errorLog,
+	}
+	for i, webhookURL := range urls {
+		notifier.queues[i] = make(chan []byte, webhookQueueSize)
+		go notifier.run(webhookURL, notifier.queues[i])
+	}
+	return notifier, nil
+}
+
+func (notifier *webhookNotifier) Notify(stateChange *entities.StateChange) {
+	if !stateChange.IsToggle() {
+		return
+	}
+	payload, err := stateChange.Current.Serialize()
+	if err != nil {
+		notifier.ErrorLog.Println("Error while forming a webhook payload:", err.Error())
+		return
+	}
+	for i, queue := range notifier.queues {
+		select {
+		case queue <- payload:
+		default:
+			notifier.ErrorLog.Printf("The webhook queue for %s is full, the notification was dropped: %s\n",
+				notifier.URLs[i], stateChange.String())
+		}
+	}
+}
+
+func (notifier *webhookNotifier) run(webhookURL string, queue chan []byte) {
+	for payload := range queue {
+		notifier.deliver(webhookURL, payload)
+	}
+}
+
+func (notifier *webhookNotifier) deliver(webhookURL string, payload []byte) {
+	retryInterval := webhookRetryInterval
+	for attempt := 1; attempt <= webhookRetries; attempt++ {
+		err := notifier.post(webhookURL, payload)
+		if err == nil {
+			notifier.InfoLog.Println("The webhook was sent to", webhookURL)
+			return
+		}
+		notifier.ErrorLog.Printf("Error while sending the webhook to %s (attempt %d of %d): %s\n",
+			webhookURL, attempt, webhookRetries, err.Error())
+		if attempt < webhookRetries {
+			time.Sleep(retryInterval)
+			retryInterval *= 2
+		}
+	}
+	notifier.ErrorLog.Printf("The webhook to %s was dropped after %d attempts\n", webhookURL, webhookRetries)
+}
+
+func (notifier *webhookNotifier) post(webhookURL string, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := notifier.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("unexpected response status %s", response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/oshokin/alarm-button/entities"
+)
+
+func main() {
+	entities.HandleVersionCommand()
+	isJSONOutput := flag.Bool("json", false, "print the current state as JSON")
+	enabledExitCode := flag.Int("enabled-exit-code", entities.AlarmPressedExitCode,
+		"exit code when the alarm button is pressed")
+	client, err := entities.NewClientWithLogOutput(os.Stderr)
+	if err != nil {
+		client.ErrorLog.Println("Error while starting client:", err.Error())
+		client.Stop(false, 1)
+	}
+	client.HandleInterrupts()
+	client.WithMetadata(map[string]string{entities.RoleMetadataKey: "status"})
+	stateResponse, err := client.QueryState()
+	if err != nil {
+		client.ErrorLog.Println("Error while requesting the alarm state:", err.Error())
+		client.Stop(false, 1)
+	}
+	if *isJSONOutput {
+		output, err := json.MarshalIndent(stateResponse, "", "  ")
+		if err != nil {
+			client.ErrorLog.Println("Error while converting data:", err.Error())
+			client.Stop(false, 1)
+		}
+		fmt.Println(string(output))
+	} else {
+		fmt.Println(stateResponse.String())
+	}
+	if stateResponse.IsAlarmButtonPressed {
+		client.Stop(false, *enabledExitCode)
+	}
+	client.Stop(false, 0)
+}
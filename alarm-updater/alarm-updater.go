@@ -2,42 +2,110 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
-	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
-	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/doitdistributed/go-update"
+	"github.com/hashicorp/go-version"
 	"github.com/mitchellh/go-ps"
 	"github.com/oshokin/alarm-button/entities"
+	"golang.org/x/sync/errgroup"
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	downloadRetryDelay   time.Duration = 2 * time.Second
+	versionDetectTimeout time.Duration = 5 * time.Second
+	backupTimeFormat     string        = "20060102-150405"
+	updateHookTimeout    time.Duration = 1 * time.Minute
+	updateNeededExitCode int           = 2
+	terminationTimeout   time.Duration = 30 * time.Second
+	manifestRetryDelay   time.Duration = 1 * time.Second
+	maxManifestDelay     time.Duration = 30 * time.Second
+)
+
+const (
+	restartEnvironmentVariable string = "ALARM_BUTTON_UPDATER_RESTARTED"
+	temporaryDirectoryPrefix   string = "alarm-button-updater-"
+	manifestCacheFileName      string = "alarm-button-version-cache.yaml"
+	installedVersionFileName   string = "alarm-button-installed-version.yaml"
+)
+
+var (
+	errInvalidVersionOutput = errors.New("invalid version output")
+	versionPattern          = regexp.MustCompile(`v?\d+\.\d+(\.\d+)?(-[0-9A-Za-z.-]+)?`)
+)
+
+type installedVersion struct {
+	Version string `yaml:"version"`
+}
+
+type Options struct {
+	UpdateType   string
+	DryRun       bool
+	CheckOnly    bool
+	RollbackFile string
+	Force        bool
+	NoStart      bool
+}
+
+type Plan struct {
+	CurrentVersion string
+	NewVersion     string
+	IsUpdateNeeded bool
+	Files          []string
+	Executable     string
+}
+
 type Updater struct {
-	UpdateDescription  *entities.UpdateDescription
-	IsUpdateNeeded     bool
-	InfoLog            *log.Logger
-	ErrorLog           *log.Logger
-	temporaryDirectory string
-	downloadedFiles    map[string]string
-	interruptChannel   chan os.Signal
+	UpdateDescription    *entities.UpdateDescription
+	IsUpdateNeeded       bool
+	StaleFiles           []string
+	Options              *Options
+	InfoLog              *log.Logger
+	ErrorLog             *log.Logger
+	localVersion         string
+	markerPath           string
+	isMarkerCreated      bool
+	stopMarkerRefresh    context.CancelFunc
+	markerRefreshDone    chan struct{}
+	fetcher              entities.UpdateFetcher
+	temporaryDirectory   string
+	downloadedFiles      map[string]string
+	downloadedFilesMutex sync.Mutex
+	bandwidthLimiter     *bandwidthLimiter
+	checksumFunction     crypto.Hash
+	interruptChannel     chan os.Signal
 }
 
 func NewUpdater() (*Updater, error) {
+	return NewUpdaterWithFetcher(nil)
+}
+
+func NewUpdaterWithFetcher(fetcher entities.UpdateFetcher) (*Updater, error) {
 	updater := Updater{
+		fetcher:          fetcher,
 		InfoLog:          log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime),
 		ErrorLog:         log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile),
 		downloadedFiles:  make(map[string]string, 16),
@@ -48,31 +116,156 @@ func NewUpdater() (*Updater, error) {
 		<-updater.interruptChannel
 		updater.Stop(1)
 	}()
-	isUpdaterRunningNow := entities.IsUpdaterRunningNow(updater.InfoLog, updater.ErrorLog)
-	if isUpdaterRunningNow {
-		return &updater, errors.New("the updater is already running")
-	}
-	updateMarker, err := os.Create(entities.UpdateMarkerFileName)
+	options, err := parseUpdaterArgs()
 	if err != nil {
 		return &updater, err
 	}
-	err = updateMarker.Close()
+	updater.Options = options
+	err = entities.ReadCommonSettingsFromFile()
 	if err != nil {
 		return &updater, err
 	}
-	err = entities.ReadCommonSettingsFromFile()
+	err = entities.ValidateDownloadFolder(entities.Settings.ServerUpdateFolder)
+	if err != nil {
+		return &updater, fmt.Errorf("invalid URI of updates folder, %w", err)
+	}
+	if options.Force {
+		updater.ErrorLog.Println("WARNING: force mode is active, the update marker is ignored " +
+			"and any running updater will be terminated")
+		err = entities.TerminateProcessByName(entities.UpdaterExecutable)
+		if err != nil {
+			updater.ErrorLog.Println("Error while terminating the running updater:", err.Error())
+		}
+	} else if entities.IsRoleUpdaterRunningNow(options.UpdateType, updater.InfoLog, updater.ErrorLog) {
+		return &updater, entities.ErrAlreadyRunning
+	}
+	if !options.DryRun && !options.CheckOnly {
+		updater.markerPath = entities.GetUpdateMarkerPath(options.UpdateType)
+		updateMarker, err := os.Create(updater.markerPath)
+		if err != nil {
+			return &updater, err
+		}
+		updater.isMarkerCreated = true
+		err = updateMarker.Close()
+		if err != nil {
+			return &updater, err
+		}
+		updater.startMarkerRefresh()
+	}
+	entities.Settings.UpdateType = options.UpdateType
+	if !options.DryRun && !options.CheckOnly {
+		err = validateTemporaryDirectory(entities.Settings.TempDir)
+		if err != nil {
+			return &updater, err
+		}
+		updater.removeStaleTemporaryDirectories()
+	}
+	updater.InfoLog.Println("Settings:", entities.Settings.String())
+	if updater.fetcher != nil {
+		return &updater, nil
+	}
+	httpClient, err := entities.NewHTTPClient(entities.Settings)
 	if err != nil {
 		return &updater, err
 	}
-	entities.Settings.UpdateType, err = parseUpdaterArgs()
+	updater.fetcher, err = entities.NewUpdateFetcher(entities.Settings.ServerUpdateFolder, httpClient)
 	if err != nil {
 		return &updater, err
 	}
 	return &updater, nil
 }
 
-func parseUpdaterArgs() (string, error) {
+func validateTemporaryDirectory(directory string) error {
+	if directory == "" {
+		return nil
+	}
+	fileInfo, err := os.Stat(directory)
+	if err != nil {
+		return fmt.Errorf("invalid temporary directory, %s", err.Error())
+	}
+	if !fileInfo.IsDir() {
+		return fmt.Errorf("the temporary directory %s is not a directory", directory)
+	}
+	testFile, err := ioutil.TempFile(directory, temporaryDirectoryPrefix)
+	if err != nil {
+		return fmt.Errorf("the temporary directory %s isn't writable, %s", directory, err.Error())
+	}
+	testFile.Close()
+	return os.Remove(testFile.Name())
+}
+
+func (updater *Updater) removeStaleTemporaryDirectories() {
+	if entities.Settings.StaleTempDirAge == 0 {
+		return
+	}
+	baseDirectory := entities.Settings.TempDir
+	if baseDirectory == "" {
+		baseDirectory = os.TempDir()
+	}
+	directories, err := filepath.Glob(filepath.Join(baseDirectory, temporaryDirectoryPrefix+"*"))
+	if err != nil {
+		updater.ErrorLog.Println("Error while searching for stale temporary directories:", err.Error())
+		return
+	}
+	for _, directory := range directories {
+		fileInfo, err := os.Stat(directory)
+		if err != nil || !fileInfo.IsDir() || time.Since(fileInfo.ModTime()) < entities.Settings.StaleTempDirAge {
+			continue
+		}
+		err = os.RemoveAll(directory)
+		if err != nil {
+			updater.ErrorLog.Println("Error while deleting the stale temporary directory:", err.Error())
+			continue
+		}
+		updater.InfoLog.Println("The stale temporary directory was deleted:", directory)
+	}
+}
+
+func (updater *Updater) startMarkerRefresh() {
+	ctx, cancel := context.WithCancel(context.Background())
+	updater.stopMarkerRefresh = cancel
+	updater.markerRefreshDone = make(chan struct{})
+	go updater.refreshUpdateMarker(ctx)
+}
+
+// stopRefreshingMarker returns after the refresher has finished, so the marker
+// can be removed without the refresher touching it or the one of a new updater.
+func (updater *Updater) stopRefreshingMarker() {
+	if updater.stopMarkerRefresh == nil {
+		return
+	}
+	updater.stopMarkerRefresh()
+	<-updater.markerRefreshDone
+}
+
+func (updater *Updater) refreshUpdateMarker(ctx context.Context) {
+	defer close(updater.markerRefreshDone)
+	ticker := time.NewTicker(entities.GetUpdateMarkerLifetime() / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		currentTime := time.Now()
+		err := os.Chtimes(updater.markerPath, currentTime, currentTime)
+		if err != nil {
+			updater.ErrorLog.Println("Error while refreshing the update marker:", err.Error())
+		}
+	}
+}
+
+func parseUpdaterArgs() (*Options, error) {
 	updateTypePointer := flag.String("type", "client", "user role")
+	dryRunPointer := flag.Bool("dry-run", false, "show what would be updated without changing anything")
+	checkOnlyPointer := flag.Bool("check-only", false,
+		"report whether an update is needed and exit (exit code 0 means up to date, 2 means an update is needed)")
+	rollbackFilePointer := flag.String("rollback", "", "restore the most recent backup of the given file and exit")
+	forcePointer := flag.Bool("force", false,
+		"ignore the update marker and terminate any running updater (use when a previous update crashed)")
+	noStartPointer := flag.Bool("no-start", false,
+		"only update the files and don't start the executables (when a service manager restarts them)")
 	flag.Parse()
 	var err error
 	if len(flag.Args()) > 0 {
@@ -80,13 +273,21 @@ func parseUpdaterArgs() (string, error) {
 	} else {
 		err = nil
 	}
-	return *updateTypePointer, err
+	return &Options{
+		UpdateType:   *updateTypePointer,
+		DryRun:       *dryRunPointer,
+		CheckOnly:    *checkOnlyPointer,
+		RollbackFile: *rollbackFilePointer,
+		Force:        *forcePointer,
+		NoStart:      *noStartPointer,
+	}, err
 }
 
 func (updater *Updater) Stop(exitCode int) {
-	_, err := os.Stat(entities.UpdateMarkerFileName)
-	if err == nil {
-		err := os.Remove(entities.UpdateMarkerFileName)
+	updater.stopRefreshingMarker()
+	_, err := os.Stat(updater.markerPath)
+	if err == nil && updater.isMarkerCreated {
+		err := os.Remove(updater.markerPath)
 		if err != nil && updater.ErrorLog != nil {
 			updater.ErrorLog.Println("Error while deleting the update marker:", err.Error())
 		}
@@ -105,6 +306,7 @@ func (updater *Updater) Stop(exitCode int) {
 }
 
 func main() {
+	entities.HandleVersionCommand()
 	updater, err := NewUpdater()
 	if err != nil {
 		updater.ErrorLog.Println("Error while launching the updater:", err.Error())
@@ -114,20 +316,49 @@ func main() {
 }
 
 func (updater *Updater) Run() {
-	updater.InfoLog.Println("Terminating alarm button processes forcibly")
-	err := updater.terminateAlarmButtonProcesses()
-	if err != nil {
-		updater.ErrorLog.Println("Error while terminating alarm button processes:", err.Error())
-		updater.Stop(1)
+	if updater.Options.DryRun {
+		updater.InfoLog.Println("Dry run mode is on, no files or processes will be changed")
+		plan, err := updater.BuildPlan()
+		if err != nil {
+			updater.ErrorLog.Println("Error while preparing the update plan:", err.Error())
+			updater.Stop(1)
+		}
+		updater.logPlan(plan)
+		updater.Stop(0)
+	}
+	if updater.Options.CheckOnly {
+		updater.runCheckOnly()
+	}
+	if updater.Options.RollbackFile != "" {
+		updater.runRollback()
 	}
 	updater.InfoLog.Println("Downloading the update description from the server")
-	err = updater.fillUpdateDescription()
+	err := updater.fillUpdateDescription()
 	if err != nil {
 		updater.ErrorLog.Println("Error while downloading version description:", err.Error())
+		if errors.Is(err, entities.ErrManifestUnavailable) && entities.Settings.SkipUpdateIfOffline {
+			updater.runWithCachedUpdateDescription()
+		}
+		updater.Stop(1)
+	}
+	if len(entities.Settings.PreUpdateCommand) > 0 && os.Getenv(restartEnvironmentVariable) == "" {
+		updater.InfoLog.Println("Running the pre-update command")
+		err = updater.runUpdateHook(entities.Settings.PreUpdateCommand)
+		if err != nil {
+			updater.ErrorLog.Println("Error while running the pre-update command:", err.Error())
+			updater.Stop(1)
+		}
+	}
+	updater.InfoLog.Println("Terminating alarm button processes forcibly")
+	terminationContext, cancel := context.WithTimeout(context.Background(), terminationTimeout)
+	err = updater.terminateAlarmButtonProcesses(terminationContext)
+	cancel()
+	if err != nil {
+		updater.ErrorLog.Println("Error while terminating alarm button processes:", err.Error())
 		updater.Stop(1)
 	}
 	updater.InfoLog.Println("Verifying the checksum of files on the client and server")
-	err = updater.validateChecksum()
+	err = updater.determineUpdateNeeded()
 	if err != nil {
 		updater.ErrorLog.Println("Error while verifying the checksum:", err.Error())
 		updater.Stop(1)
@@ -145,99 +376,472 @@ func (updater *Updater) Run() {
 			updater.ErrorLog.Println("Error while updating files on the client:", err.Error())
 			updater.Stop(1)
 		}
+		updater.saveInstalledVersion()
+		if _, isUpdaterUpdated := updater.downloadedFiles[entities.UpdaterExecutable]; isUpdaterUpdated {
+			updater.restartUpdater()
+		}
 	} else {
 		updater.InfoLog.Println("No update required")
+		if updater.localVersion == "" {
+			updater.saveInstalledVersion()
+		}
 	}
-	updater.InfoLog.Println("Starting required executables")
-	err = updater.startRequiredExecutables()
+	updater.startExecutablesUnlessDisabled()
+	if len(entities.Settings.PostUpdateCommand) > 0 {
+		updater.InfoLog.Println("Running the post-update command")
+		err = updater.runUpdateHook(entities.Settings.PostUpdateCommand)
+		if err != nil {
+			updater.ErrorLog.Println("Warning: the post-update command failed:", err.Error())
+		}
+	}
+	updater.InfoLog.Println("Exiting the updater now")
+	updater.Stop(0)
+}
+
+func (updater *Updater) restartUpdater() {
+	if os.Getenv(restartEnvironmentVariable) != "" {
+		updater.ErrorLog.Println("The updater has already been restarted once, finishing the update without restarting")
+		return
+	}
+	updater.InfoLog.Println("The updater itself was updated, restarting it to finish the update")
+	executablePath, err := filepath.Abs(updater.UpdateDescription.GetTargetPath(entities.UpdaterExecutable))
 	if err != nil {
-		updater.ErrorLog.Println("Error while starting required executables:", err.Error())
+		updater.ErrorLog.Println("Error while restarting the updater:", err.Error())
+		return
+	}
+	updater.stopRefreshingMarker()
+	err = os.Remove(updater.markerPath)
+	if err != nil {
+		updater.ErrorLog.Println("Error while restarting the updater:", err.Error())
+		updater.startMarkerRefresh()
+		return
+	}
+	updater.isMarkerCreated = false
+	command := exec.Command(executablePath, os.Args[1:]...)
+	command.Env = append(os.Environ(), restartEnvironmentVariable+"=1")
+	command.Stdin = os.Stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+	err = command.Start()
+	if err != nil {
+		updater.ErrorLog.Println("Error while restarting the updater, finishing the update with the current process:",
+			err.Error())
+		updateMarker, err := os.Create(updater.markerPath)
+		if err == nil {
+			updateMarker.Close()
+			updater.isMarkerCreated = true
+			updater.startMarkerRefresh()
+		}
+		return
+	}
+	updater.InfoLog.Printf("The new updater was started with PID %d\n", command.Process.Pid)
+	updater.Stop(0)
+}
+
+func (updater *Updater) runCheckOnly() {
+	plan, err := updater.BuildPlan()
+	if err != nil {
+		updater.ErrorLog.Println("Error while checking for updates:", err.Error())
 		updater.Stop(1)
 	}
-	updater.InfoLog.Println("Exiting the updater now")
+	if !plan.IsUpdateNeeded {
+		updater.InfoLog.Printf("The files of the role %s are up to date\n", entities.Settings.UpdateType)
+		updater.Stop(0)
+	}
+	currentVersion := plan.CurrentVersion
+	if currentVersion == "" {
+		currentVersion = "unknown"
+	}
+	updater.InfoLog.Printf("An update from version %s to version %s is needed\n", currentVersion, plan.NewVersion)
+	updater.InfoLog.Println("Stale files:", strings.Join(plan.Files, ", "))
+	updater.Stop(updateNeededExitCode)
+}
+
+func (updater *Updater) runRollback() {
+	updater.InfoLog.Println("Terminating alarm button processes forcibly")
+	terminationContext, cancel := context.WithTimeout(context.Background(), terminationTimeout)
+	err := updater.terminateAlarmButtonProcesses(terminationContext)
+	cancel()
+	if err != nil {
+		updater.ErrorLog.Println("Error while terminating alarm button processes:", err.Error())
+		updater.Stop(1)
+	}
+	err = updater.Rollback(updater.Options.RollbackFile)
+	if err != nil {
+		updater.ErrorLog.Println("Error while restoring the backup:", err.Error())
+		updater.Stop(1)
+	}
+	err = os.Remove(installedVersionFileName)
+	if err != nil && !os.IsNotExist(err) {
+		updater.ErrorLog.Println("Error while removing the installed version:", err.Error())
+	}
+	updater.InfoLog.Println("The backup was restored, restart the alarm button executables if needed")
 	updater.Stop(0)
 }
 
-func (updater *Updater) terminateAlarmButtonProcesses() error {
+func (updater *Updater) BuildPlan() (*Plan, error) {
+	updater.InfoLog.Println("Downloading the update description from the server")
+	err := updater.fillUpdateDescription()
+	if err != nil {
+		return nil, err
+	}
+	updater.InfoLog.Println("Verifying the checksum of files on the client and server")
+	err = updater.determineUpdateNeeded()
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{
+		CurrentVersion: updater.localVersion,
+		NewVersion:     updater.UpdateDescription.VersionNumber,
+		IsUpdateNeeded: updater.IsUpdateNeeded,
+		Files:          make([]string, 0, len(updater.StaleFiles)),
+		Executable:     updater.UpdateDescription.Executables[entities.Settings.UpdateType],
+	}
+	if updater.IsUpdateNeeded {
+		plan.Files = append(plan.Files, updater.StaleFiles...)
+	}
+	return plan, nil
+}
+
+func (updater *Updater) logPlan(plan *Plan) {
+	if plan.IsUpdateNeeded {
+		currentVersion := plan.CurrentVersion
+		if currentVersion == "" {
+			currentVersion = "unknown"
+		}
+		updater.InfoLog.Printf("The version would be updated from %s to %s\n", currentVersion, plan.NewVersion)
+		updater.InfoLog.Println("Files that would be updated:", strings.Join(plan.Files, ", "))
+	} else {
+		updater.InfoLog.Println("No update required")
+	}
+	if plan.Executable != "" {
+		updater.InfoLog.Println("Executable that would be started:", plan.Executable)
+	} else {
+		updater.InfoLog.Printf("Unable to find a executable for the user role %s\n", entities.Settings.UpdateType)
+	}
+}
+
+func (updater *Updater) terminateAlarmButtonProcesses(ctx context.Context) error {
 	executableFiles := entities.SliceToStringMap(entities.FilesWithChecksum)
 	processList, err := ps.Processes()
 	if err != nil {
 		return err
 	}
 	thisProcessID := os.Getpid()
+	problems := make([]string, 0)
 	for processIndex := range processList {
+		if ctx.Err() != nil {
+			return fmt.Errorf("the termination of processes was interrupted, %s", ctx.Err().Error())
+		}
 		process := processList[processIndex]
 		processID := process.Pid()
 		if processID == thisProcessID {
 			continue
 		}
 		processName := process.Executable()
-		if _, found := executableFiles[processName]; found {
-			runningProcess, err := os.FindProcess(processID)
-			if err != nil {
-				return err
-			}
-			err = runningProcess.Kill()
-			if err != nil {
-				return err
-			}
+		if _, found := executableFiles[processName]; !found {
+			continue
+		}
+		err = killProcess(processID)
+		if isProcessFinished(err) {
+			continue
 		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s (PID %d): %s", processName, processID, err.Error()))
+			continue
+		}
+		updater.InfoLog.Printf("The process %s (PID %d) was terminated\n", processName, processID)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("unable to terminate %d process(es):\n%s", len(problems), strings.Join(problems, "\n"))
 	}
 	return nil
 }
 
+func killProcess(processID int) error {
+	runningProcess, err := os.FindProcess(processID)
+	if err != nil {
+		return err
+	}
+	return runningProcess.Kill()
+}
+
+func isProcessFinished(err error) bool {
+	return errors.Is(err, os.ErrProcessDone) || errors.Is(err, syscall.ESRCH)
+}
+
+func (updater *Updater) runWithCachedUpdateDescription() {
+	updater.InfoLog.Println("Checking the local files against the cached update description")
+	data, err := os.ReadFile(manifestCacheFileName)
+	if err == nil {
+		err = updater.parseUpdateDescription(data)
+	}
+	if err == nil {
+		err = updater.validateChecksum()
+	}
+	if err != nil {
+		updater.ErrorLog.Println("Error while reading the cached update description:", err.Error())
+		updater.Stop(1)
+	}
+	if updater.IsUpdateNeeded {
+		updater.ErrorLog.Println("The local files don't match the cached update description:",
+			strings.Join(updater.StaleFiles, ", "))
+		updater.Stop(1)
+	}
+	updater.InfoLog.Println("The local files match the cached update description, skipping the update")
+	updater.startExecutablesUnlessDisabled()
+	updater.Stop(0)
+}
+
+func (updater *Updater) startExecutablesUnlessDisabled() {
+	if updater.Options.NoStart {
+		updater.InfoLog.Println("Starting executables is disabled, the caller is responsible for restarting them")
+		return
+	}
+	updater.InfoLog.Println("Starting required executables")
+	err := updater.startRequiredExecutables()
+	if err != nil {
+		updater.ErrorLog.Println("Error while starting required executables:", err.Error())
+		updater.Stop(1)
+	}
+}
+
 func (updater *Updater) fillUpdateDescription() error {
-	response, err := updater.getFileBodyFromServer(entities.VersionFileName)
-	if response != nil {
-		defer response.Body.Close()
+	data, err := updater.fetchUpdateDescription(context.Background())
+	if err != nil {
+		return err
 	}
+	err = updater.parseUpdateDescription(data)
 	if err != nil {
 		return err
 	}
-	data, err := io.ReadAll(response.Body)
+	if updater.Options.DryRun || updater.Options.CheckOnly {
+		return nil
+	}
+	err = os.WriteFile(manifestCacheFileName, data, entities.DefaultFileMode)
+	if err != nil {
+		updater.ErrorLog.Println("Error while caching the update description:", err.Error())
+	}
+	return nil
+}
+
+func (updater *Updater) fetchUpdateDescription(ctx context.Context) ([]byte, error) {
+	retryDelay := manifestRetryDelay
+	var err error
+	for attempt := 0; attempt <= entities.Settings.ManifestRetries; attempt++ {
+		if attempt > 0 {
+			updater.ErrorLog.Printf("Error while downloading the update description (attempt %d of %d): %s\n",
+				attempt, entities.Settings.ManifestRetries+1, err.Error())
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(retryDelay):
+			}
+			retryDelay *= 2
+			if retryDelay > maxManifestDelay {
+				retryDelay = maxManifestDelay
+			}
+		}
+		var data []byte
+		data, err = updater.fetchUpdateDescriptionAttempt(ctx)
+		if err == nil {
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("%w, %s", entities.ErrManifestUnavailable, err.Error())
+}
+
+func (updater *Updater) fetchUpdateDescriptionAttempt(ctx context.Context) ([]byte, error) {
+	updateFile, err := updater.fetcher.Fetch(ctx, entities.VersionFileName, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer updateFile.Body.Close()
+	return io.ReadAll(updateFile.Body)
+}
+
+func (updater *Updater) parseUpdateDescription(data []byte) error {
+	err := yaml.Unmarshal(data, &updater.UpdateDescription)
 	if err != nil {
 		return err
 	}
-	err = yaml.Unmarshal(data, &updater.UpdateDescription)
+	err = updater.UpdateDescription.CheckManifestVersion()
 	if err != nil {
 		return err
 	}
+	updater.checksumFunction, err = updater.UpdateDescription.GetChecksumFunction()
+	if err != nil {
+		return err
+	}
+	err = updater.UpdateDescription.ValidatePaths()
+	if err != nil {
+		return err
+	}
+	err = updater.UpdateDescription.ValidateInstallRoots(entities.Settings.InstallRoots)
+	if err != nil {
+		return err
+	}
+	_, err = updater.UpdateDescription.GetRoleFiles(entities.Settings.UpdateType)
+	return err
+}
+
+func (updater *Updater) determineUpdateNeeded() error {
+	err := updater.validateChecksum()
+	if err != nil {
+		return err
+	}
+	updater.localVersion = updater.detectLocalVersion()
+	if updater.IsUpdateNeeded {
+		updater.IsUpdateNeeded = updater.compareVersions(updater.localVersion,
+			updater.UpdateDescription.VersionNumber)
+	}
 	return nil
 }
 
-func (updater *Updater) getFileBodyFromServer(fileName string) (*http.Response, error) {
-	serverUpdateURL, err := url.Parse(entities.Settings.ServerUpdateFolder)
+// detectLocalVersion reads the version recorded by the last update. Installed
+// executables are run only when the update description allows it: the ones
+// built before the version command would ignore the argument and start for real.
+func (updater *Updater) detectLocalVersion() string {
+	data, err := os.ReadFile(installedVersionFileName)
+	if os.IsNotExist(err) {
+		if !updater.UpdateDescription.ProbeVersion {
+			return ""
+		}
+		return updater.detectExecutableVersion()
+	}
+	localVersion := installedVersion{}
+	if err == nil {
+		err = yaml.Unmarshal(data, &localVersion)
+	}
+	if err != nil {
+		updater.ErrorLog.Println("Error while reading the installed version:", err.Error())
+		return ""
+	}
+	return localVersion.Version
+}
+
+func (updater *Updater) saveInstalledVersion() {
+	data, err := yaml.Marshal(&installedVersion{Version: updater.UpdateDescription.VersionNumber})
+	if err == nil {
+		err = os.WriteFile(installedVersionFileName, data, entities.DefaultFileMode)
+	}
 	if err != nil {
-		return nil, err
+		updater.ErrorLog.Println("Error while saving the installed version:", err.Error())
+	}
+}
+
+func (updater *Updater) detectExecutableVersion() string {
+	executable, isExecutableFound := updater.UpdateDescription.Executables[entities.Settings.UpdateType]
+	if !isExecutableFound {
+		return ""
+	}
+	executablePath := getExecutablePath(updater.UpdateDescription.GetTargetPath(executable))
+	if _, err := os.Stat(executablePath); err != nil {
+		return ""
+	}
+	versionNumber, err := getExecutableVersion(executablePath)
+	if err != nil {
+		updater.InfoLog.Printf("Warning: unable to detect the version of %s: %s\n", executable, err.Error())
+		return ""
+	}
+	return versionNumber
+}
+
+func getExecutableVersion(executablePath string) (string, error) {
+	output, err := runVersionCommand(executablePath, "version", "-output", entities.JSONVersionOutput)
+	if err == nil {
+		versionNumber, err := parseJSONVersionOutput(output)
+		if err == nil {
+			return versionNumber, nil
+		}
 	}
-	serverUpdateURL.Path = path.Join(serverUpdateURL.Path, fileName)
-	finalURL := serverUpdateURL.String()
-	response, err := http.Get(finalURL)
+	output, err = runVersionCommand(executablePath, "version")
 	if err != nil {
-		return response, err
+		return "", err
 	}
-	if response.StatusCode != 200 {
-		return response, fmt.Errorf("%s, %s", finalURL, response.Status)
+	return parseVersionFromOutput(string(output))
+}
+
+func runVersionCommand(executablePath string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), versionDetectTimeout)
+	defer cancel()
+	return exec.CommandContext(ctx, executablePath, args...).Output()
+}
+
+func parseJSONVersionOutput(output []byte) (string, error) {
+	versionInfo := entities.VersionInfo{}
+	err := json.Unmarshal(output, &versionInfo)
+	if err != nil {
+		return "", err
+	}
+	if versionInfo.Version == "" {
+		return "", errInvalidVersionOutput
+	}
+	return versionInfo.Version, nil
+}
+
+func parseVersionFromOutput(output string) (string, error) {
+	versionNumber := versionPattern.FindString(output)
+	if versionNumber == "" {
+		return "", errInvalidVersionOutput
 	}
-	return response, err
+	return versionNumber, nil
+}
+
+func getExecutablePath(fileName string) string {
+	if filepath.IsAbs(fileName) {
+		return fileName
+	}
+	return "." + string(filepath.Separator) + fileName
+}
+
+func (updater *Updater) compareVersions(localVersionNumber string, serverVersionNumber string) bool {
+	if localVersionNumber == "" {
+		updater.InfoLog.Println("The local version is unknown, an update is needed")
+		return true
+	}
+	localVersion, err := version.NewVersion(localVersionNumber)
+	if err != nil {
+		updater.InfoLog.Printf("Warning: unable to parse the local version %s, comparing the versions as strings: %s\n",
+			localVersionNumber, err.Error())
+		return localVersionNumber != serverVersionNumber
+	}
+	serverVersion, err := version.NewVersion(serverVersionNumber)
+	if err != nil {
+		updater.InfoLog.Printf("Warning: unable to parse the server version %s, comparing the versions as strings: %s\n",
+			serverVersionNumber, err.Error())
+		return localVersionNumber != serverVersionNumber
+	}
+	if serverVersion.GreaterThan(localVersion) {
+		return true
+	}
+	if serverVersion.Equal(localVersion) {
+		updater.InfoLog.Printf("The local version %s is the same as the server version, skipping the update\n",
+			localVersion)
+		return false
+	}
+	if entities.Settings.AllowDowngrade {
+		updater.InfoLog.Printf("Downgrading from version %s to version %s\n", localVersion, serverVersion)
+		return true
+	}
+	updater.InfoLog.Printf("The server version %s is older than the local version %s, skipping the update\n",
+		serverVersion, localVersion)
+	return false
 }
 
 func (updater *Updater) validateChecksum() error {
-	files, areRolesFound := updater.UpdateDescription.Roles[entities.Settings.UpdateType]
-	if !areRolesFound {
-		return fmt.Errorf("unable to find a list of files for the user role %s", entities.Settings.UpdateType)
+	files, err := updater.UpdateDescription.GetRoleFiles(entities.Settings.UpdateType)
+	if err != nil {
+		return err
 	}
 	for _, fileName := range files {
-		serverFileBase64, isServerChecksumFound := updater.UpdateDescription.Files[fileName]
-		if !isServerChecksumFound {
-			return fmt.Errorf("the checksum of the file %s is not set on the server", fileName)
-		}
-		serverFileChecksum, err := base64.StdEncoding.DecodeString(serverFileBase64)
+		serverFileChecksum, err := updater.getServerChecksum(fileName)
 		if err != nil {
 			return err
 		}
 		isClientChecksumCorrect := true
-		if _, err := os.Stat(fileName); err != nil {
+		targetPath := updater.UpdateDescription.GetTargetPath(fileName)
+		if _, err := os.Stat(targetPath); err != nil {
 			if os.IsNotExist(err) {
 				isClientChecksumCorrect = false
 			} else {
@@ -245,7 +849,7 @@ func (updater *Updater) validateChecksum() error {
 			}
 		}
 		if isClientChecksumCorrect {
-			clientChecksum, err := entities.GetFileChecksum(fileName)
+			clientChecksum, err := entities.GetFileChecksum(targetPath, updater.checksumFunction)
 			if err != nil {
 				return err
 			}
@@ -255,87 +859,433 @@ func (updater *Updater) validateChecksum() error {
 			}
 		}
 		if !isClientChecksumCorrect {
-			updater.IsUpdateNeeded = true
-			return nil
+			updater.StaleFiles = append(updater.StaleFiles, fileName)
 		}
 	}
+	updater.IsUpdateNeeded = len(updater.StaleFiles) > 0
 	return nil
 }
 
+func (updater *Updater) getServerChecksum(fileName string) ([]byte, error) {
+	serverFileBase64, isServerChecksumFound := updater.UpdateDescription.Files[fileName]
+	if !isServerChecksumFound {
+		return nil, fmt.Errorf("the checksum of the file %s is not set on the server", fileName)
+	}
+	return base64.StdEncoding.DecodeString(serverFileBase64)
+}
+
+func (updater *Updater) getServerCompressedChecksum(fileName string) ([]byte, error) {
+	serverFileBase64, isServerChecksumFound := updater.UpdateDescription.CompressedFiles[fileName]
+	if !isServerChecksumFound {
+		return nil, fmt.Errorf("the checksum of the compressed file %s is not set on the server", fileName)
+	}
+	return base64.StdEncoding.DecodeString(serverFileBase64)
+}
+
 func (updater *Updater) downloadFiles() error {
-	temporaryDirectory, err := ioutil.TempDir("", "alarm-button-updater-")
+	temporaryDirectory, err := ioutil.TempDir(entities.Settings.TempDir, temporaryDirectoryPrefix)
 	if err != nil {
 		return err
 	}
 	updater.temporaryDirectory = temporaryDirectory
-	files := updater.UpdateDescription.Roles[entities.Settings.UpdateType]
+	if entities.Settings.MaxDownloadBytesPerSec > 0 {
+		updater.bandwidthLimiter = newBandwidthLimiter(entities.Settings.MaxDownloadBytesPerSec)
+	}
+	files, err := updater.UpdateDescription.GetRoleFiles(entities.Settings.UpdateType)
+	if err != nil {
+		return err
+	}
+	group, groupContext := errgroup.WithContext(context.Background())
+	group.SetLimit(entities.Settings.DownloadConcurrency)
 	for _, fileName := range files {
-		response, err := updater.getFileBodyFromServer(fileName)
-		if err != nil {
-			if response != nil {
-				response.Body.Close()
+		fileName := fileName
+		group.Go(func() error {
+			return updater.downloadFile(groupContext, fileName)
+		})
+	}
+	err = group.Wait()
+	if err != nil {
+		updater.removeDownloadedFiles()
+		return err
+	}
+	return nil
+}
+
+func (updater *Updater) downloadFile(ctx context.Context, fileName string) error {
+	remoteFileName, err := updater.UpdateDescription.GetRemoteFileName(fileName)
+	if err != nil {
+		return err
+	}
+	var serverFileChecksum []byte
+	if remoteFileName == fileName {
+		serverFileChecksum, err = updater.getServerChecksum(fileName)
+	} else {
+		serverFileChecksum, err = updater.getServerCompressedChecksum(fileName)
+	}
+	if err != nil {
+		return err
+	}
+	outputFileName := filepath.Join(updater.temporaryDirectory, remoteFileName)
+	isResumeSupported := false
+	var downloadedFileChecksum []byte
+	for attempt := 0; attempt <= entities.Settings.DownloadRetries; attempt++ {
+		if attempt > 0 {
+			var offset int64
+			if isResumeSupported {
+				offset = getFileSize(outputFileName)
+			}
+			updater.InfoLog.Printf("[%s] Retrying the download (attempt %d of %d) from byte offset %d\n",
+				fileName, attempt, entities.Settings.DownloadRetries, offset)
+			select {
+			case <-ctx.Done():
+				err = ctx.Err()
+			case <-time.After(downloadRetryDelay):
+			}
+			if ctx.Err() != nil {
+				break
 			}
-			return err
 		}
-		outputFileName := filepath.Join(temporaryDirectory, fileName)
-		outputFile, err := os.Create(outputFileName)
+		isResumeSupported, downloadedFileChecksum, err = updater.downloadFileAttempt(ctx,
+			remoteFileName, outputFileName, isResumeSupported)
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		updater.ErrorLog.Printf("[%s] Error while downloading the file: %s\n", fileName, err.Error())
+	}
+	if err == nil && !bytes.Equal(serverFileChecksum, downloadedFileChecksum) {
+		err = &entities.ChecksumMismatchError{File: remoteFileName}
+	}
+	if err == nil && remoteFileName != fileName {
+		compressedFileName := outputFileName
+		outputFileName = filepath.Join(updater.temporaryDirectory, fileName)
+		err = updater.decompressFile(fileName, compressedFileName, outputFileName)
+		os.Remove(compressedFileName)
+	}
+	if err != nil {
+		os.Remove(outputFileName)
+		return err
+	}
+	updater.downloadedFilesMutex.Lock()
+	updater.downloadedFiles[fileName] = outputFileName
+	updater.downloadedFilesMutex.Unlock()
+	updater.InfoLog.Printf("[%s] The file %s was downloaded successfully\n", fileName, outputFileName)
+	return nil
+}
+
+func (updater *Updater) downloadFileAttempt(ctx context.Context,
+	fileName string, outputFileName string, isResumeAllowed bool) (bool, []byte, error) {
+	var offset int64
+	if isResumeAllowed {
+		offset = getFileSize(outputFileName)
+	}
+	updateFile, err := updater.fetcher.Fetch(ctx, fileName, offset)
+	if err != nil {
+		return isResumeAllowed, nil, err
+	}
+	defer updateFile.Body.Close()
+	hasher, err := entities.NewChecksumHasher(updater.checksumFunction)
+	if err != nil {
+		return isResumeAllowed, nil, err
+	}
+	isResumeSupported := updateFile.IsResumeSupported
+	openFlags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	var resumedBytes int64
+	if updateFile.Offset > 0 {
+		resumedBytes = updateFile.Offset
+		openFlags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		err = hashExistingFile(hasher, outputFileName)
 		if err != nil {
-			response.Body.Close()
-			return err
+			return isResumeSupported, nil, err
+		}
+	}
+	outputFile, err := os.OpenFile(outputFileName, openFlags, entities.DefaultFileMode)
+	if err != nil {
+		return isResumeSupported, nil, err
+	}
+	var body io.Reader = updateFile.Body
+	if updater.bandwidthLimiter != nil {
+		body = &throttledReader{ctx: ctx, reader: body, limiter: updater.bandwidthLimiter}
+	}
+	progress := &progressReader{
+		reader:        body,
+		infoLog:       updater.InfoLog,
+		fileName:      fileName,
+		bytesRead:     resumedBytes,
+		contentLength: updateFile.ContentLength,
+		lastLogTime:   time.Now(),
+		interval:      entities.Settings.ProgressInterval,
+	}
+	if progress.contentLength >= 0 {
+		progress.contentLength += resumedBytes
+	}
+	_, err = io.Copy(io.MultiWriter(outputFile, hasher), progress)
+	closeErr := outputFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return isResumeSupported, nil, err
+	}
+	return isResumeSupported, hasher.Sum(nil), nil
+}
+
+type progressReader struct {
+	reader        io.Reader
+	infoLog       *log.Logger
+	fileName      string
+	bytesRead     int64
+	contentLength int64
+	lastLogTime   time.Time
+	interval      time.Duration
+}
+
+func (progress *progressReader) Read(buffer []byte) (int, error) {
+	bytesRead, err := progress.reader.Read(buffer)
+	progress.bytesRead += int64(bytesRead)
+	if progress.interval > 0 && time.Since(progress.lastLogTime) >= progress.interval {
+		progress.lastLogTime = time.Now()
+		if progress.contentLength > 0 {
+			progress.infoLog.Printf("[%s] Downloaded %d%% (%d of %d bytes)\n", progress.fileName,
+				progress.bytesRead*100/progress.contentLength, progress.bytesRead, progress.contentLength)
+		} else {
+			progress.infoLog.Printf("[%s] Downloaded %d bytes\n", progress.fileName, progress.bytesRead)
 		}
-		_, err = io.Copy(outputFile, response.Body)
-		response.Body.Close()
+	}
+	return bytesRead, err
+}
+
+func (updater *Updater) decompressFile(fileName string, compressedFileName string, outputFileName string) error {
+	serverFileChecksum, err := updater.getServerChecksum(fileName)
+	if err != nil {
+		return err
+	}
+	compressedFile, err := os.Open(compressedFileName)
+	if err != nil {
+		return err
+	}
+	defer compressedFile.Close()
+	gzipReader, err := gzip.NewReader(compressedFile)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+	outputFile, err := os.OpenFile(outputFileName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, entities.DefaultFileMode)
+	if err != nil {
+		return err
+	}
+	hasher, err := entities.NewChecksumHasher(updater.checksumFunction)
+	if err != nil {
 		outputFile.Close()
+		return err
+	}
+	_, err = io.Copy(io.MultiWriter(outputFile, hasher), gzipReader)
+	closeErr := outputFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(serverFileChecksum, hasher.Sum(nil)) {
+		return &entities.ChecksumMismatchError{File: fileName}
+	}
+	return nil
+}
+
+func hashExistingFile(hasher hash.Hash, fileName string) error {
+	existingFile, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer existingFile.Close()
+	_, err = io.Copy(hasher, existingFile)
+	return err
+}
 
+func getFileSize(fileName string) int64 {
+	fileInfo, err := os.Stat(fileName)
+	if err != nil {
+		return 0
+	}
+	return fileInfo.Size()
+}
+
+func (updater *Updater) removeDownloadedFiles() {
+	updater.downloadedFilesMutex.Lock()
+	defer updater.downloadedFilesMutex.Unlock()
+	for fileName, downloadedFileName := range updater.downloadedFiles {
+		err := os.Remove(downloadedFileName)
+		if err != nil && !os.IsNotExist(err) {
+			updater.ErrorLog.Printf("[%s] Error while deleting the downloaded file: %s\n", fileName, err.Error())
+		}
+		delete(updater.downloadedFiles, fileName)
+	}
+}
+
+type appliedFile struct {
+	fileName    string
+	targetPath  string
+	oldFileName string
+	isNewFile   bool
+}
+
+func (updater *Updater) updateFiles() error {
+	fileNames := make([]string, 0, len(updater.downloadedFiles))
+	for fileName := range updater.downloadedFiles {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+	appliedFiles := make([]*appliedFile, 0, len(fileNames))
+	for _, fileName := range fileNames {
+		applied, err := updater.updateFile(fileName, updater.downloadedFiles[fileName])
 		if err != nil {
+			updater.rollbackFiles(appliedFiles)
 			return err
 		}
-		updater.downloadedFiles[fileName] = outputFileName
-		updater.InfoLog.Printf("The file %s was downloaded successfully\n", outputFileName)
+		appliedFiles = append(appliedFiles, applied)
+	}
+	for _, applied := range appliedFiles {
+		if _, err := os.Stat(applied.oldFileName); err != nil {
+			continue
+		}
+		if applied.isNewFile || entities.Settings.KeepBackups == 0 {
+			os.Remove(applied.oldFileName)
+			continue
+		}
+		err := updater.keepBackup(applied)
+		if err != nil {
+			updater.ErrorLog.Printf("Error while keeping a backup of the file %s: %s\n", applied.fileName, err.Error())
+		}
 	}
 	return nil
 }
 
-func (updater *Updater) updateFiles() error {
-	for fileName, downloadedFileName := range updater.downloadedFiles {
-		updater.InfoLog.Printf("Updating the file %s\n", fileName)
-		data, err := os.ReadFile(downloadedFileName)
+func (updater *Updater) keepBackup(applied *appliedFile) error {
+	backupFileName := fmt.Sprintf("%s.%s", applied.oldFileName, time.Now().Format(backupTimeFormat))
+	err := os.Rename(applied.oldFileName, backupFileName)
+	if err != nil {
+		return err
+	}
+	updater.InfoLog.Printf("The previous version of the file %s was saved to %s\n", applied.fileName, backupFileName)
+	backupFileNames, err := getBackupFileNames(applied.targetPath)
+	if err != nil {
+		return err
+	}
+	for i := entities.Settings.KeepBackups; i < len(backupFileNames); i++ {
+		err = os.Remove(backupFileNames[i])
 		if err != nil {
 			return err
 		}
-		updater.InfoLog.Println("Looking for a checksum")
-		downloadedFileBase64, isChecksumFound := updater.UpdateDescription.Files[fileName]
-		if !isChecksumFound {
-			return fmt.Errorf("the checksum of the %s file is not set", downloadedFileName)
+	}
+	return nil
+}
+
+func getBackupFileNames(fileName string) ([]string, error) {
+	backupFileNames, err := filepath.Glob(fmt.Sprintf("%s.old.*", fileName))
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(backupFileNames)))
+	return backupFileNames, nil
+}
+
+func (updater *Updater) Rollback(fileName string) error {
+	backupFileNames, err := getBackupFileNames(fileName)
+	if err != nil {
+		return err
+	}
+	if len(backupFileNames) == 0 {
+		return fmt.Errorf("no backups of the file %s were found", fileName)
+	}
+	updater.InfoLog.Printf("Restoring the file %s from %s\n", fileName, backupFileNames[0])
+	return os.Rename(backupFileNames[0], fileName)
+}
+
+func (updater *Updater) updateFile(fileName string, downloadedFileName string) (*appliedFile, error) {
+	updater.InfoLog.Printf("Updating the file %s\n", fileName)
+	updater.InfoLog.Println("Looking for a checksum")
+	downloadedFileChecksum, err := updater.getServerChecksum(fileName)
+	if err != nil {
+		return nil, err
+	}
+	targetPath := updater.UpdateDescription.GetTargetPath(fileName)
+	applied := &appliedFile{
+		fileName:    fileName,
+		targetPath:  targetPath,
+		oldFileName: fmt.Sprintf("%s.old", targetPath),
+	}
+	if targetPath != fileName {
+		updater.InfoLog.Println("Installing the file to", targetPath)
+		err = os.MkdirAll(filepath.Dir(targetPath), entities.DefaultFileMode)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create the directory of %s, %s", targetPath, err.Error())
 		}
-		downloadedFileChecksum, err := base64.StdEncoding.DecodeString(downloadedFileBase64)
+	}
+	if _, err := os.Stat(targetPath); err != nil && os.IsNotExist(err) {
+		newFile, err := os.Create(targetPath)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if _, err := os.Stat(fileName); err != nil && os.IsNotExist(err) {
-			_, err := os.Create(fileName)
-			if err != nil {
-				return err
-			}
+		newFile.Close()
+		applied.isNewFile = true
+	}
+	updater.InfoLog.Println("Applying update")
+	options := &update.Options{
+		TargetPath:  targetPath,
+		TargetMode:  entities.DefaultFileMode,
+		Checksum:    downloadedFileChecksum,
+		Hash:        updater.checksumFunction,
+		OldSavePath: applied.oldFileName,
+	}
+	downloadedFile, err := os.Open(downloadedFileName)
+	if err == nil {
+		err = update.Apply(downloadedFile, *options)
+		downloadedFile.Close()
+	}
+	if err != nil {
+		if applied.isNewFile {
+			os.Remove(targetPath)
 		}
-		updater.InfoLog.Println("Applying update")
-		options := &update.Options{
-			TargetPath: fileName,
-			TargetMode: entities.DefaultFileMode,
-			Checksum:   downloadedFileChecksum,
-			Hash:       entities.DefaultChecksumFunction,
+		return nil, err
+	}
+	return applied, nil
+}
+
+func (updater *Updater) rollbackFiles(appliedFiles []*appliedFile) {
+	for i := len(appliedFiles) - 1; i >= 0; i-- {
+		applied := appliedFiles[i]
+		updater.InfoLog.Printf("Rolling back the file %s\n", applied.fileName)
+		err := os.Remove(applied.targetPath)
+		if err != nil && !os.IsNotExist(err) {
+			updater.ErrorLog.Printf("Error while rolling back the file %s: %s\n", applied.fileName, err.Error())
+			continue
 		}
-		dataReader := bytes.NewReader(data)
-		err = update.Apply(dataReader, *options)
-		if err != nil {
-			return err
+		if applied.isNewFile {
+			os.Remove(applied.oldFileName)
+			continue
 		}
-		oldFileName := fmt.Sprintf("%s.old", fileName)
-		if _, err := os.Stat(oldFileName); err == nil {
-			os.Remove(oldFileName)
+		err = os.Rename(applied.oldFileName, applied.targetPath)
+		if err != nil {
+			updater.ErrorLog.Printf("Error while rolling back the file %s: %s\n", applied.fileName, err.Error())
 		}
 	}
-	return nil
+}
+
+func (updater *Updater) runUpdateHook(hookCommand []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), updateHookTimeout)
+	defer cancel()
+	updater.InfoLog.Println("Running the command:", strings.Join(hookCommand, " "))
+	command := exec.CommandContext(ctx, hookCommand[0], hookCommand[1:]...)
+	command.Env = append(os.Environ(),
+		fmt.Sprintf("ALARM_BUTTON_UPDATE_TYPE=%s", entities.Settings.UpdateType),
+		fmt.Sprintf("ALARM_BUTTON_VERSION=%s", updater.UpdateDescription.VersionNumber))
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+	err := command.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("the command didn't finish within %s", updateHookTimeout)
+	}
+	return err
 }
 
 func (updater *Updater) startRequiredExecutables() error {
@@ -343,6 +1293,7 @@ func (updater *Updater) startRequiredExecutables() error {
 	if !isExecutableFound {
 		return fmt.Errorf("unable to find a executable for the user role %s", entities.Settings.UpdateType)
 	}
+	executable = getExecutablePath(updater.UpdateDescription.GetTargetPath(executable))
 	osLC := strings.ToLower(runtime.GOOS)
 	if strings.Contains(osLC, "linux") || strings.Contains(osLC, "darwin") {
 		return exec.Command(executable).Start()
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/oshokin/alarm-button/entities"
+)
+
+func TestCompareVersions(t *testing.T) {
+	testCases := []struct {
+		localVersion       string
+		serverVersion      string
+		isDowngradeAllowed bool
+		isUpdateNeeded     bool
+	}{
+		{"", "1.0.0", false, true},
+		{"1.2.0", "1.10.0", false, true},
+		{"1.10.0", "1.2.0", false, false},
+		{"1.10.0", "1.2.0", true, true},
+		{"1.2.0", "1.2.0", false, false},
+		{"1.2.0", "1.2.0", true, false},
+		{"v1.2.0", "1.2.0", false, false},
+		{"1.2.0-rc.1", "1.2.0", false, true},
+		{"1.2.0", "1.2.0-rc.1", false, false},
+		{"1.2.0-alpha", "1.2.0-beta", false, true},
+		{"1.2.0-beta", "1.2.0-alpha", false, false},
+		{"unknown", "1.2.0", false, true},
+		{"1.2.0", "latest", false, true},
+		{"nightly", "nightly", false, false},
+	}
+	for _, testCase := range testCases {
+		updater := newTestUpdater(t)
+		entities.Settings.AllowDowngrade = testCase.isDowngradeAllowed
+		isUpdateNeeded := updater.compareVersions(testCase.localVersion, testCase.serverVersion)
+		if isUpdateNeeded != testCase.isUpdateNeeded {
+			t.Errorf("%q to %q (downgrade allowed %t): expected an update %t, got %t", testCase.localVersion,
+				testCase.serverVersion, testCase.isDowngradeAllowed, testCase.isUpdateNeeded, isUpdateNeeded)
+		}
+	}
+}
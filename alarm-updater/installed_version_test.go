@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/oshokin/alarm-button/entities"
+)
+
+func TestDetectLocalVersionWithoutRecordedVersion(t *testing.T) {
+	updater := newTestUpdater(t)
+	if localVersion := updater.detectLocalVersion(); localVersion != "" {
+		t.Fatalf("expected an unknown version, got %q", localVersion)
+	}
+}
+
+func TestDetectLocalVersionReadsSavedVersion(t *testing.T) {
+	updater := newTestUpdater(t)
+	updater.UpdateDescription.VersionNumber = "1.2.3"
+	updater.saveInstalledVersion()
+	if localVersion := updater.detectLocalVersion(); localVersion != "1.2.3" {
+		t.Fatalf("expected the saved version, got %q", localVersion)
+	}
+}
+
+func TestDetectLocalVersionIgnoresInvalidFile(t *testing.T) {
+	updater := newTestUpdater(t)
+	err := os.WriteFile(installedVersionFileName, []byte("version: [1"), entities.DefaultFileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if localVersion := updater.detectLocalVersion(); localVersion != "" {
+		t.Fatalf("expected an unknown version, got %q", localVersion)
+	}
+}
+
+func writeTestExecutable(t *testing.T, fileName string, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the test executable is a shell script")
+	}
+	err := os.WriteFile(fileName, []byte("#!/bin/sh\n"+script), entities.DefaultFileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseJSONVersionOutput(t *testing.T) {
+	testCases := []struct {
+		output        string
+		versionNumber string
+		isValid       bool
+	}{
+		{`{"version":"1.2.3","commit":"abc","buildTime":"now"}`, "1.2.3", true},
+		{`{"version":"v2.0.0-rc.1"}`, "v2.0.0-rc.1", true},
+		{`{"commit":"abc"}`, "", false},
+		{`version: 1.2.3, commit: abc`, "", false},
+	}
+	for _, testCase := range testCases {
+		versionNumber, err := parseJSONVersionOutput([]byte(testCase.output))
+		if (err == nil) != testCase.isValid || versionNumber != testCase.versionNumber {
+			t.Errorf("%q: expected %q (valid %t), got %q and %v", testCase.output,
+				testCase.versionNumber, testCase.isValid, versionNumber, err)
+		}
+	}
+}
+
+func TestDetectLocalVersionProbesExecutableOnlyWhenAllowed(t *testing.T) {
+	updater := newTestUpdater(t)
+	updater.UpdateDescription.Executables = map[string]string{"client": "alarm-checker"}
+	writeTestExecutable(t, "alarm-checker",
+		`[ "$1 $2 $3" = "version -output json" ] && echo '{"version":"1.2.3"}'`+"\n")
+	if localVersion := updater.detectLocalVersion(); localVersion != "" {
+		t.Fatalf("expected the executable not to be run, got %q", localVersion)
+	}
+	updater.UpdateDescription.ProbeVersion = true
+	if localVersion := updater.detectLocalVersion(); localVersion != "1.2.3" {
+		t.Fatalf("expected the version from the JSON output, got %q", localVersion)
+	}
+	updater.UpdateDescription.VersionNumber = "2.0.0"
+	updater.saveInstalledVersion()
+	if localVersion := updater.detectLocalVersion(); localVersion != "2.0.0" {
+		t.Fatalf("expected the recorded version to take precedence, got %q", localVersion)
+	}
+}
+
+func TestParseVersionFromOutput(t *testing.T) {
+	testCases := []struct {
+		output        string
+		versionNumber string
+		isValid       bool
+	}{
+		{"1.2.3\n", "1.2.3", true},
+		{"v1.2.3\n", "v1.2.3", true},
+		{"version: 1.2.3, commit: abc, build time: now\n", "1.2.3", true},
+		{"версия: 2.0.1-rc.1, коммит: abc\n", "2.0.1-rc.1", true},
+		{"alarm-checker 1.10\n", "1.10", true},
+		{"unknown\n", "", false},
+		{"", "", false},
+	}
+	for _, testCase := range testCases {
+		versionNumber, err := parseVersionFromOutput(testCase.output)
+		if (err == nil) != testCase.isValid || versionNumber != testCase.versionNumber {
+			t.Errorf("%q: expected %q (valid %t), got %q and %v", testCase.output,
+				testCase.versionNumber, testCase.isValid, versionNumber, err)
+		}
+	}
+}
+
+func TestDetectLocalVersionFallsBackToTextOutput(t *testing.T) {
+	updater := newTestUpdater(t)
+	updater.UpdateDescription.Executables = map[string]string{"client": "alarm-checker"}
+	updater.UpdateDescription.ProbeVersion = true
+	writeTestExecutable(t, "alarm-checker", `[ "$#" = 1 ] && echo "version: 1.2.3, commit: abc"`+"\n")
+	if localVersion := updater.detectLocalVersion(); localVersion != "1.2.3" {
+		t.Fatalf("expected the version from the text output, got %q", localVersion)
+	}
+	writeTestExecutable(t, "alarm-checker", "echo unknown\n")
+	if localVersion := updater.detectLocalVersion(); localVersion != "" {
+		t.Fatalf("expected an unknown version, got %q", localVersion)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+const throttledReadSize int = 32 * 1024
+
+type bandwidthLimiter struct {
+	bytesPerSecond float64
+	burstBytes     float64
+	availableBytes float64
+	lastUpdateTime time.Time
+	mutex          sync.Mutex
+}
+
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	burstBytes := float64(bytesPerSecond)
+	if burstBytes < float64(throttledReadSize) {
+		burstBytes = float64(throttledReadSize)
+	}
+	return &bandwidthLimiter{
+		bytesPerSecond: float64(bytesPerSecond),
+		burstBytes:     burstBytes,
+		lastUpdateTime: time.Now(),
+	}
+}
+
+func (limiter *bandwidthLimiter) Wait(ctx context.Context, bytesCount int) error {
+	limiter.mutex.Lock()
+	currentTime := time.Now()
+	limiter.availableBytes += currentTime.Sub(limiter.lastUpdateTime).Seconds() * limiter.bytesPerSecond
+	if limiter.availableBytes > limiter.burstBytes {
+		limiter.availableBytes = limiter.burstBytes
+	}
+	limiter.lastUpdateTime = currentTime
+	limiter.availableBytes -= float64(bytesCount)
+	var delay time.Duration
+	if limiter.availableBytes < 0 {
+		delay = time.Duration(-limiter.availableBytes / limiter.bytesPerSecond * float64(time.Second))
+	}
+	limiter.mutex.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	delayTimer := time.NewTimer(delay)
+	defer delayTimer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-delayTimer.C:
+		return nil
+	}
+}
+
+type throttledReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *bandwidthLimiter
+}
+
+func (throttled *throttledReader) Read(buffer []byte) (int, error) {
+	if len(buffer) > throttledReadSize {
+		buffer = buffer[:throttledReadSize]
+	}
+	bytesRead, err := throttled.reader.Read(buffer)
+	if bytesRead > 0 {
+		waitErr := throttled.limiter.Wait(throttled.ctx, bytesRead)
+		if waitErr != nil {
+			return bytesRead, waitErr
+		}
+	}
+	return bytesRead, err
+}
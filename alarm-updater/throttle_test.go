@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oshokin/alarm-button/entities"
+)
+
+const (
+	testBandwidthLimit int64         = 100 * 1024
+	minThrottledTime   time.Duration = 400 * time.Millisecond
+	maxThrottledTime   time.Duration = 2 * time.Second
+)
+
+func assertThrottledTime(t *testing.T, elapsedTime time.Duration) {
+	t.Helper()
+	if elapsedTime < minThrottledTime || elapsedTime > maxThrottledTime {
+		t.Fatalf("expected the transfer to take about 500ms, it took %s", elapsedTime)
+	}
+}
+
+func TestThrottledReaderLimitsBandwidth(t *testing.T) {
+	body := bytes.Repeat([]byte{1}, int(testBandwidthLimit/2))
+	reader := &throttledReader{
+		ctx:     context.Background(),
+		reader:  bytes.NewReader(body),
+		limiter: newBandwidthLimiter(testBandwidthLimit),
+	}
+	startTime := time.Now()
+	bytesCount, err := io.Copy(ioutil.Discard, reader)
+	if err != nil || bytesCount != int64(len(body)) {
+		t.Fatalf("expected %d bytes, read %d: %v", len(body), bytesCount, err)
+	}
+	assertThrottledTime(t, time.Since(startTime))
+}
+
+func TestBandwidthLimiterIsSharedByConcurrentReaders(t *testing.T) {
+	limiter := newBandwidthLimiter(testBandwidthLimit)
+	var readers sync.WaitGroup
+	startTime := time.Now()
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			reader := &throttledReader{
+				ctx:     context.Background(),
+				reader:  bytes.NewReader(bytes.Repeat([]byte{1}, int(testBandwidthLimit/8))),
+				limiter: limiter,
+			}
+			io.Copy(ioutil.Discard, reader)
+		}()
+	}
+	readers.Wait()
+	assertThrottledTime(t, time.Since(startTime))
+}
+
+func TestThrottledReaderStopsWhenContextIsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	reader := &throttledReader{
+		ctx:     ctx,
+		reader:  bytes.NewReader(bytes.Repeat([]byte{1}, 1024*1024)),
+		limiter: newBandwidthLimiter(1024),
+	}
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err := io.Copy(ioutil.Discard, reader)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the read to be canceled, got %v", err)
+	}
+}
+
+func TestUpdaterDownloadsRespectBandwidthLimit(t *testing.T) {
+	updateFolder := &testUpdateFolder{
+		Files: []testUpdateFolderFile{
+			{Name: "first", Contents: bytes.Repeat([]byte{1}, int(testBandwidthLimit/4)), Roles: []string{"client"}},
+			{Name: "second", Contents: bytes.Repeat([]byte{2}, int(testBandwidthLimit/4)), Roles: []string{"client"}},
+		},
+		Executables: map[string]string{"client": "first"},
+	}
+	updater := newTestMemoryUpdater(t, updateFolder)
+	entities.Settings.MaxDownloadBytesPerSec = testBandwidthLimit
+	err := updater.fillUpdateDescription()
+	if err != nil {
+		t.Fatal(err)
+	}
+	startTime := time.Now()
+	err = updater.downloadFiles()
+	elapsedTime := time.Since(startTime)
+	os.RemoveAll(updater.temporaryDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertThrottledTime(t, elapsedTime)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oshokin/alarm-button/entities"
+	"gopkg.in/yaml.v3"
+)
+
+type testUpdateFolderFile struct {
+	Name         string
+	Contents     []byte
+	Roles        []string
+	IsCompressed bool
+}
+
+// testUpdateFolder describes the files served by a test update folder. The update
+// description with the checksums of the files is generated by Build.
+type testUpdateFolder struct {
+	VersionNumber string
+	HashAlgorithm string
+	Files         []testUpdateFolderFile
+	Executables   map[string]string
+}
+
+// Build returns the update description and the contents of every file of the
+// update folder by its remote name, including the update description itself.
+func (folder *testUpdateFolder) Build() (*entities.UpdateDescription, map[string][]byte, error) {
+	updateDescription := entities.NewUpdateDescription()
+	if folder.VersionNumber != "" {
+		updateDescription.VersionNumber = folder.VersionNumber
+	}
+	if folder.HashAlgorithm != "" {
+		updateDescription.HashAlgorithm = folder.HashAlgorithm
+	}
+	for userRole, executable := range folder.Executables {
+		updateDescription.Executables[userRole] = executable
+	}
+	checksumFunction, err := updateDescription.GetChecksumFunction()
+	if err != nil {
+		return nil, nil, err
+	}
+	getChecksum := func(contents []byte) (string, error) {
+		hasher, err := entities.NewChecksumHasher(checksumFunction)
+		if err != nil {
+			return "", err
+		}
+		hasher.Write(contents)
+		return base64.StdEncoding.EncodeToString(hasher.Sum(nil)), nil
+	}
+	files := make(map[string][]byte, len(folder.Files)+1)
+	for _, file := range folder.Files {
+		updateDescription.Files[file.Name], err = getChecksum(file.Contents)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, userRole := range file.Roles {
+			updateDescription.Roles[userRole] = append(updateDescription.Roles[userRole], file.Name)
+		}
+		if !file.IsCompressed {
+			files[file.Name] = file.Contents
+			continue
+		}
+		var compressedContents bytes.Buffer
+		gzipWriter := gzip.NewWriter(&compressedContents)
+		_, err = gzipWriter.Write(file.Contents)
+		if err == nil {
+			err = gzipWriter.Close()
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		updateDescription.Compression[file.Name] = entities.GzipCompression
+		updateDescription.CompressedFiles[file.Name], err = getChecksum(compressedContents.Bytes())
+		if err != nil {
+			return nil, nil, err
+		}
+		files[file.Name+entities.GzipFileExtension] = compressedContents.Bytes()
+	}
+	files[entities.VersionFileName], err = yaml.Marshal(updateDescription)
+	if err != nil {
+		return nil, nil, err
+	}
+	return updateDescription, files, nil
+}
+
+// Write stores the update folder in the directory and returns its update description.
+func (folder *testUpdateFolder) Write(t testing.TB, directory string) *entities.UpdateDescription {
+	t.Helper()
+	updateDescription, files, err := folder.Build()
+	if err != nil {
+		t.Fatalf("unable to build the update folder: %s", err.Error())
+	}
+	for fileName, contents := range files {
+		err = os.WriteFile(filepath.Join(directory, fileName), contents, entities.DefaultFileMode)
+		if err != nil {
+			t.Fatalf("unable to write the update folder: %s", err.Error())
+		}
+	}
+	return updateDescription
+}
+
+// Serve starts an HTTP server with the update folder and returns its URL.
+// The server is closed when the test finishes.
+func (folder *testUpdateFolder) Serve(t testing.TB) string {
+	t.Helper()
+	directory := t.TempDir()
+	folder.Write(t, directory)
+	server := httptest.NewServer(http.FileServer(http.Dir(directory)))
+	t.Cleanup(server.Close)
+	return server.URL + "/"
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStopRefreshingMarkerWaitsForRefresher(t *testing.T) {
+	updater := newTestUpdater(t)
+	updater.markerPath = filepath.Join(t.TempDir(), "marker")
+	updater.startMarkerRefresh()
+	stoppedChannel := make(chan struct{})
+	go func() {
+		updater.stopRefreshingMarker()
+		updater.stopRefreshingMarker()
+		close(stoppedChannel)
+	}()
+	select {
+	case <-stoppedChannel:
+	case <-time.After(time.Second):
+		t.Fatal("expected the marker refresher to stop")
+	}
+	select {
+	case <-updater.markerRefreshDone:
+	default:
+		t.Fatal("expected the marker refresher to be finished")
+	}
+	if _, err := os.Stat(updater.markerPath); !os.IsNotExist(err) {
+		t.Fatal("expected the refresher not to create the marker")
+	}
+}
+
+func TestStopRefreshingMarkerWithoutRefresher(t *testing.T) {
+	updater := newTestUpdater(t)
+	updater.stopRefreshingMarker()
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oshokin/alarm-button/entities"
+)
+
+// newTestUpdater returns an updater for the client role that works in a
+// temporary directory with the default settings.
+func newTestUpdater(t *testing.T) *Updater {
+	t.Helper()
+	workingDirectory, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousSettings := entities.Settings
+	entities.Settings = &entities.CommonSettings{
+		UpdateType:          "client",
+		DownloadConcurrency: entities.DefaultDownloadConcurrency,
+	}
+	t.Cleanup(func() {
+		entities.Settings = previousSettings
+		os.Chdir(workingDirectory)
+	})
+	return &Updater{
+		UpdateDescription: &entities.UpdateDescription{},
+		Options:           &Options{UpdateType: "client"},
+		InfoLog:           log.New(ioutil.Discard, "", 0),
+		ErrorLog:          log.New(ioutil.Discard, "", 0),
+		downloadedFiles:   make(map[string]string),
+	}
+}
+
+func newTestUpdateFolder() *testUpdateFolder {
+	return &testUpdateFolder{
+		VersionNumber: "1.2.3",
+		Files: []testUpdateFolderFile{
+			{Name: "alarm-checker", Contents: []byte("checker"), Roles: []string{"client"}},
+			{Name: "alarm-button-on", Contents: bytes.Repeat([]byte("on"), 4096), Roles: []string{"client"},
+				IsCompressed: true},
+			{Name: "alarm-server", Contents: []byte("server"), Roles: []string{"server"}},
+		},
+		Executables: map[string]string{"client": "alarm-checker", "server": "alarm-server"},
+	}
+}
+
+func runTestUpdate(t *testing.T, updater *Updater) {
+	t.Helper()
+	err := updater.fillUpdateDescription()
+	if err == nil {
+		err = updater.determineUpdateNeeded()
+	}
+	if err == nil && updater.IsUpdateNeeded {
+		err = updater.downloadFiles()
+		if err == nil {
+			err = updater.updateFiles()
+		}
+		os.RemoveAll(updater.temporaryDirectory)
+	}
+	if err != nil {
+		t.Fatalf("unable to update: %s", err.Error())
+	}
+}
+
+func assertInstalledFiles(t *testing.T, updateFolder *testUpdateFolder) {
+	t.Helper()
+	for _, file := range updateFolder.Files {
+		contents, err := os.ReadFile(file.Name)
+		if file.Roles[0] != "client" {
+			if !os.IsNotExist(err) {
+				t.Fatalf("expected the file %s of another role not to be installed", file.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unable to read the installed file: %s", err.Error())
+		}
+		if !bytes.Equal(contents, file.Contents) {
+			t.Fatalf("the installed file %s doesn't match the update folder", file.Name)
+		}
+	}
+}
+
+func TestUpdaterFetchesAndAppliesFilesOverHTTP(t *testing.T) {
+	updateFolder := newTestUpdateFolder()
+	updateFolderURL := updateFolder.Serve(t)
+	updater := newTestUpdater(t)
+	fetcher, err := entities.NewUpdateFetcher(updateFolderURL, http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updater.fetcher = fetcher
+	runTestUpdate(t, updater)
+	if !updater.IsUpdateNeeded {
+		t.Fatal("expected an update to be needed")
+	}
+	assertInstalledFiles(t, updateFolder)
+	updater.StaleFiles = nil
+	runTestUpdate(t, updater)
+	if updater.IsUpdateNeeded {
+		t.Fatalf("expected no update after the files were applied, stale files: %v", updater.StaleFiles)
+	}
+}
+
+func TestUpdaterFetchesAndAppliesFilesFromLocalFolder(t *testing.T) {
+	updateFolder := newTestUpdateFolder()
+	directory := t.TempDir()
+	updateFolder.Write(t, directory)
+	for _, updateFolderPath := range []string{directory, "file://" + filepath.ToSlash(directory)} {
+		updater := newTestUpdater(t)
+		fetcher, err := entities.NewUpdateFetcher(updateFolderPath, http.DefaultClient)
+		if err != nil {
+			t.Fatal(err)
+		}
+		updater.fetcher = fetcher
+		runTestUpdate(t, updater)
+		if !updater.IsUpdateNeeded {
+			t.Fatalf("expected an update from %s to be needed", updateFolderPath)
+		}
+		assertInstalledFiles(t, updateFolder)
+	}
+}
+
+func TestUpdaterRejectsFileWithWrongChecksum(t *testing.T) {
+	updateFolder := newTestUpdateFolder()
+	directory := t.TempDir()
+	updateFolder.Write(t, directory)
+	err := os.WriteFile(filepath.Join(directory, "alarm-checker"), []byte("tampered"), entities.DefaultFileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updater := newTestUpdater(t)
+	updater.fetcher, err = entities.NewUpdateFetcher(directory, http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = updater.fillUpdateDescription()
+	if err == nil {
+		err = updater.determineUpdateNeeded()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = updater.downloadFiles()
+	os.RemoveAll(updater.temporaryDirectory)
+	var checksumMismatchError *entities.ChecksumMismatchError
+	if !errors.As(err, &checksumMismatchError) {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+	if _, err := os.Stat("alarm-checker"); !os.IsNotExist(err) {
+		t.Fatal("expected the tampered file not to be installed")
+	}
+}
+
+func newTestMemoryUpdater(t *testing.T, updateFolder *testUpdateFolder) *Updater {
+	t.Helper()
+	_, files, err := updateFolder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	updater := newTestUpdater(t)
+	updater.fetcher = entities.NewMemoryUpdateFetcher(files)
+	return updater
+}
+
+func TestUpdaterRollsBackAppliedFilesWhenThirdFileFails(t *testing.T) {
+	updateFolder := newTestUpdateFolder()
+	updateFolder.Files = append(updateFolder.Files, testUpdateFolderFile{
+		Name: "alarm-button-off", Contents: []byte("off"), Roles: []string{"client"},
+	})
+	updater := newTestMemoryUpdater(t, updateFolder)
+	// The files are applied in the order of their names, so alarm-checker is the third one.
+	previousContents := map[string]string{
+		"alarm-button-off": "previous off",
+		"alarm-button-on":  "previous on",
+		"alarm-checker":    "previous checker",
+	}
+	for fileName, contents := range previousContents {
+		err := os.WriteFile(fileName, []byte(contents), entities.DefaultFileMode)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A non-empty directory in place of the backup can't be replaced by the old file.
+	err := os.MkdirAll(filepath.Join("alarm-checker.old", "locked"), entities.DefaultFileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = updater.fillUpdateDescription()
+	if err == nil {
+		err = updater.determineUpdateNeeded()
+	}
+	if err == nil {
+		err = updater.downloadFiles()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = updater.updateFiles()
+	os.RemoveAll(updater.temporaryDirectory)
+	if err == nil {
+		t.Fatal("expected the update of alarm-checker to fail")
+	}
+	for fileName, contents := range previousContents {
+		installedContents, err := os.ReadFile(fileName)
+		if err != nil {
+			t.Fatalf("unable to read the file %s: %s", fileName, err.Error())
+		}
+		if string(installedContents) != contents {
+			t.Fatalf("expected the file %s to be restored, got %q", fileName, installedContents)
+		}
+	}
+	for _, fileName := range []string{"alarm-button-off.old", "alarm-button-on.old"} {
+		if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+			t.Fatalf("expected the backup %s to be moved back", fileName)
+		}
+	}
+}
+
+func TestUpdaterAppliesFilesFromMemory(t *testing.T) {
+	updateFolder := newTestUpdateFolder()
+	updater := newTestMemoryUpdater(t, updateFolder)
+	runTestUpdate(t, updater)
+	assertInstalledFiles(t, updateFolder)
+	if updater.UpdateDescription.VersionNumber != "1.2.3" {
+		t.Fatalf("unexpected version %s", updater.UpdateDescription.VersionNumber)
+	}
+}
+
+func TestUpdaterSkipsDowngradeUnlessAllowed(t *testing.T) {
+	for _, isDowngradeAllowed := range []bool{false, true} {
+		updater := newTestMemoryUpdater(t, newTestUpdateFolder())
+		entities.Settings.AllowDowngrade = isDowngradeAllowed
+		updater.UpdateDescription.VersionNumber = "2.0.0"
+		updater.saveInstalledVersion()
+		err := updater.fillUpdateDescription()
+		if err == nil {
+			err = updater.determineUpdateNeeded()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(updater.StaleFiles) == 0 {
+			t.Fatal("expected the files to be stale")
+		}
+		if updater.IsUpdateNeeded != isDowngradeAllowed {
+			t.Fatalf("expected the update to be needed: %t, got %t", isDowngradeAllowed, updater.IsUpdateNeeded)
+		}
+	}
+}
+
+func TestUpdaterFailsWithoutUpdateDescription(t *testing.T) {
+	updater := newTestUpdater(t)
+	updater.fetcher = entities.NewMemoryUpdateFetcher(map[string][]byte{})
+	err := updater.fillUpdateDescription()
+	if !errors.Is(err, entities.ErrManifestUnavailable) {
+		t.Fatalf("expected the update description to be unavailable, got %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package entities
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	actedStateCacheSize int           = 16
+	actedStateLifetime  time.Duration = 24 * time.Hour
+)
+
+type actedStateCache struct {
+	actedAt map[string]time.Time
+	keys    []string
+}
+
+func getActedStateKey(stateResponse *StateResponse) string {
+	return fmt.Sprintf("%d:%d:%t", stateResponse.Sequence,
+		stateResponse.DateTime.UnixNano(), stateResponse.IsAlarmButtonPressed)
+}
+
+func (cache *actedStateCache) IsActedOn(stateResponse *StateResponse) bool {
+	actedAt, isKeyFound := cache.actedAt[getActedStateKey(stateResponse)]
+	return isKeyFound && time.Since(actedAt) < actedStateLifetime
+}
+
+func (cache *actedStateCache) Remember(stateResponse *StateResponse) {
+	if cache.actedAt == nil {
+		cache.actedAt = make(map[string]time.Time, actedStateCacheSize)
+	}
+	key := getActedStateKey(stateResponse)
+	if _, isKeyFound := cache.actedAt[key]; !isKeyFound {
+		cache.keys = append(cache.keys, key)
+	}
+	cache.actedAt[key] = time.Now()
+	for len(cache.keys) > actedStateCacheSize {
+		delete(cache.actedAt, cache.keys[0])
+		cache.keys = cache.keys[1:]
+	}
+}
@@ -0,0 +1,85 @@
+package entities
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+)
+
+func newTestChecker(commandRunner CommandRunner) *Client {
+	return &Client{
+		OperatingSystem:      "linux",
+		IsAlarmButtonPressed: true,
+		Options:              &ClientOptions{Action: ShutdownAction, MinSeverity: CriticalSeverity},
+		InfoLog:              log.New(ioutil.Discard, "", 0),
+		ErrorLog:             log.New(ioutil.Discard, "", 0),
+		commandRunner:        commandRunner,
+	}
+}
+
+func newTestPressedState() *StateResponse {
+	return &StateResponse{
+		DateTime:             time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		IsAlarmButtonPressed: true,
+		Severity:             CriticalSeverity,
+		Sequence:             7,
+	}
+}
+
+func TestCheckerShutsDownOnceForRepeatedState(t *testing.T) {
+	shutdownCount := 0
+	client := newTestChecker(func(command string, args ...string) error {
+		shutdownCount++
+		return nil
+	})
+	for i := 0; i < 2; i++ {
+		err := client.processAlarmButtonState(newTestPressedState())
+		if err != nil && !errors.Is(err, errRunFinished) {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+	}
+	if shutdownCount != 1 {
+		t.Fatalf("expected a single shutdown, got %d", shutdownCount)
+	}
+}
+
+func TestCheckerRetriesFailedShutdown(t *testing.T) {
+	shutdownCount := 0
+	client := newTestChecker(func(command string, args ...string) error {
+		shutdownCount++
+		if shutdownCount == 1 {
+			return errors.New("shutdown failed")
+		}
+		return nil
+	})
+	err := client.processAlarmButtonState(newTestPressedState())
+	if err == nil || errors.Is(err, errRunFinished) {
+		t.Fatalf("expected the failed shutdown to be reported, got %v", err)
+	}
+	err = client.processAlarmButtonState(newTestPressedState())
+	if !errors.Is(err, errRunFinished) {
+		t.Fatalf("expected the shutdown to be retried, got %v", err)
+	}
+	if shutdownCount != 2 {
+		t.Fatalf("expected two shutdown attempts, got %d", shutdownCount)
+	}
+}
+
+func TestActedStateCacheIsBounded(t *testing.T) {
+	var cache actedStateCache
+	firstState := newTestPressedState()
+	cache.Remember(firstState)
+	for i := 0; i < actedStateCacheSize; i++ {
+		state := newTestPressedState()
+		state.Sequence = uint64(100 + i)
+		cache.Remember(state)
+	}
+	if cache.IsActedOn(firstState) {
+		t.Fatal("expected the oldest state to be evicted")
+	}
+	if len(cache.actedAt) != actedStateCacheSize {
+		t.Fatalf("expected %d remembered states, got %d", actedStateCacheSize, len(cache.actedAt))
+	}
+}
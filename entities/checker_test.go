@@ -0,0 +1,109 @@
+package entities
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+)
+
+// startTestStateServer answers state and server information requests with
+// the given state until the test finishes.
+func startTestStateServer(t *testing.T, stateResponse *StateResponse) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to start the test server: %s", err.Error())
+	}
+	t.Cleanup(func() {
+		listener.Close()
+	})
+	go func() {
+		for {
+			connection, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go answerTestRequest(connection, stateResponse)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func answerTestRequest(connection net.Conn, stateResponse *StateResponse) {
+	defer connection.Close()
+	message := &Message{}
+	err := json.NewDecoder(connection).Decode(message)
+	if err != nil {
+		return
+	}
+	var response []byte
+	switch message.Type {
+	case "ServerInfoRequest":
+		response, err = SerializeWithTypeName("ServerInfoResponse", NewServerInfoResponse())
+	case "StateRequest":
+		response, err = SerializeWithTypeName("StateResponse", stateResponse)
+	default:
+		response, err = SerializeWithTypeName("ErrorResponse",
+			&ErrorResponse{Code: InvalidRequestError, Message: "unexpected request"})
+	}
+	if err == nil {
+		connection.Write(response)
+	}
+}
+
+func TestRunCheckerFinishesInProcess(t *testing.T) {
+	for _, isOnce := range []bool{true, false} {
+		serverSocket := startTestStateServer(t, newTestPressedState())
+		Settings = storeTestSettings(t, "serverSocket: "+serverSocket+"\nupdateFolder: /updates\n")
+		shutdownCount := 0
+		client := newTestChecker(func(command string, args ...string) error {
+			shutdownCount++
+			return nil
+		})
+		client.Initiator = &InitiatorData{Host: "host", User: "user"}
+		client.Options.Once = isOnce
+		err := client.RunChecker()
+		if err != nil {
+			t.Fatalf("once %t: expected the checker to finish, got %s", isOnce, err.Error())
+		}
+		if shutdownCount != 1 {
+			t.Fatalf("once %t: expected a single shutdown, got %d", isOnce, shutdownCount)
+		}
+	}
+}
+
+func TestRunCheckerReturnsBlockedShutdown(t *testing.T) {
+	stateResponse := newTestPressedState()
+	stateResponse.Severity = WarningSeverity
+	serverSocket := startTestStateServer(t, stateResponse)
+	Settings = storeTestSettings(t, "serverSocket: "+serverSocket+"\nupdateFolder: /updates\n")
+	client := newTestChecker(func(command string, args ...string) error {
+		t.Fatal("expected the shutdown to be blocked")
+		return nil
+	})
+	client.Initiator = &InitiatorData{Host: "host", User: "user"}
+	client.Options.Once = true
+	client.Options.OnBlockedShutdown = ExitBlockedShutdown
+	err := client.RunChecker()
+	if !errors.Is(err, ErrShutdownBlocked) {
+		t.Fatalf("expected the blocked shutdown to be returned, got %v", err)
+	}
+}
+
+func TestRunCheckerReturnsUnreachableServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverSocket := listener.Addr().String()
+	listener.Close()
+	Settings = storeTestSettings(t, "serverSocket: "+serverSocket+"\nupdateFolder: /updates\n")
+	client := newTestChecker(nil)
+	client.Initiator = &InitiatorData{Host: "host", User: "user"}
+	client.Options.Once = true
+	err = client.RunChecker()
+	if err == nil {
+		t.Fatal("expected an error for an unreachable server")
+	}
+}
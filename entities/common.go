@@ -1,23 +1,37 @@
 package entities
 
 import (
+	"bytes"
+	"context"
 	"crypto"
+	"crypto/rand"
+	_ "crypto/sha256"
 	_ "crypto/sha512"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"hash"
+	"io"
 	"log"
 	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
 	"os/user"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
+	"unicode"
 
 	"github.com/mitchellh/go-ps"
 	"gopkg.in/yaml.v3"
@@ -25,22 +39,91 @@ import (
 
 const (
 	CurrentVersion       string        = "1.2.0"
+	DefaultUserAgent     string        = "alarm-updater/" + CurrentVersion
+	ProtocolVersion      int           = 1
 	LauncherSleepTime    time.Duration = 1 * time.Second
 	UpdateMarkerLifeTime time.Duration = 30 * time.Second
 	SettingsFileName     string        = "alarm-button-settings.yaml"
 	VersionFileName      string        = "alarm-button-version.yaml"
-	UpdateMarkerFileName string        = "alarm-button-update-marker.bin"
+	RolesFileName        string        = "alarm-button-roles.yaml"
+	GzipCompression      string        = "gzip"
+	GzipFileExtension    string        = ".gz"
+	UnixSocketPrefix     string        = "unix://"
+	ShutdownAction       string        = "shutdown"
+	NotifyAction         string        = "notify"
+	CommandAction        string        = "command"
+	UnauthenticatedError string        = "unauthenticated"
+	RateLimitedError     string        = "rateLimited"
+	InvalidRequestError  string        = "invalidRequest"
+	AlarmPressedExitCode int           = 2
+	MaxReasonLength      int           = 256
+	UpdateMarkerPattern  string        = "alarm-button-update-marker-%s.bin"
 	ServerExecutable     string        = "alarm-server.exe"
 	CheckerExecutable    string        = "alarm-checker.exe"
 	UpdaterExecutable    string        = "alarm-updater.exe"
 	DefaultFileMode      os.FileMode   = 0755
 	//хеш-функция должна быть импортирована выше, иначе ничего не заработает
 	//import _ "crypto/sha512"
-	DefaultChecksumFunction crypto.Hash   = crypto.SHA512
-	clientBufferSize        uint          = 1024
-	clientSleepTime         time.Duration = 5 * time.Second
+	DefaultChecksumFunction    crypto.Hash   = crypto.SHA512
+	SHA512HashAlgorithm        string        = "sha512"
+	SHA256HashAlgorithm        string        = "sha256"
+	CurrentManifestVersion     int           = 1
+	DefaultDownloadConcurrency int           = 4
+	DefaultDownloadRetries     int           = 3
+	DefaultManifestRetries     int           = 3
+	DefaultStaleTempDirAge     time.Duration = 24 * time.Hour
+	DefaultProgressInterval    time.Duration = 5 * time.Second
+	DefaultHTTPTimeout         time.Duration = 30 * time.Second
+	DefaultRequestTimeout      time.Duration = 30 * time.Second
+	clientMaxMessageSize       int64         = 64 * 1024
+	clientDrainTimeout         time.Duration = 5 * time.Second
+	DefaultPollInterval        time.Duration = 5 * time.Second
+	InitialRetryInterval       time.Duration = 1 * time.Second
+	MaxRetryInterval           time.Duration = 30 * time.Second
+	MinPollInterval            time.Duration = 500 * time.Millisecond
+	httpDialTimeout            time.Duration = 10 * time.Second
+	httpKeepAlive              time.Duration = 30 * time.Second
+	httpIdleConnectionTimeout  time.Duration = 90 * time.Second
+	httpMaxIdleConnections     int           = 16
+	LogBlockedShutdown         string        = "log"
+	ExitBlockedShutdown        string        = "exit"
+	CommandBlockedShutdown     string        = "command"
+	ShutdownBlockedExitCode    int           = 3
+	MaxIdempotencyKeyLength    int           = 128
 )
 
+const (
+	InitiatorHostEnvironmentVariable string = "ALARM_BUTTON_INITIATOR_HOST"
+	InitiatorUserEnvironmentVariable string = "ALARM_BUTTON_INITIATOR_USER"
+	RoleMetadataKey                  string = "x-alarm-role"
+	VersionMetadataKey               string = "x-alarm-version"
+	SettingsFileEnvironmentVariable  string = "ALARM_BUTTON_SETTINGS_FILE"
+	StandardInputFileName            string = "-"
+)
+
+var (
+	getHostName = os.Hostname
+	getUserName = func() (string, error) {
+		currentUser, err := user.Current()
+		if err != nil {
+			return "", err
+		}
+		return currentUser.Username, nil
+	}
+)
+
+var (
+	systemInitiatorOnce sync.Once
+	systemInitiator     struct {
+		hostName      string
+		hostNameError error
+		userName      string
+		userNameError error
+	}
+)
+
+type initiatorContextKey struct{}
+
 var (
 	Settings         *CommonSettings
 	AllowedUserRoles = map[string][]string{
@@ -55,34 +138,270 @@ var (
 )
 
 type CommonSettings struct {
-	ServerUpdateFolder string `yaml:"updateFolder"`
-	ServerSocket       string `yaml:"serverSocket"`
-	UpdateType         string `yaml:"-"`
+	ServerUpdateFolder     string        `yaml:"updateFolder"`
+	ServerSocket           string        `yaml:"serverSocket"`
+	ServerSockets          []string      `yaml:"serverSockets,omitempty"`
+	DownloadConcurrency    int           `yaml:"downloadConcurrency,omitempty"`
+	DownloadRetries        int           `yaml:"downloadRetries,omitempty"`
+	AllowDowngrade         bool          `yaml:"allowDowngrade,omitempty"`
+	ProgressInterval       time.Duration `yaml:"downloadProgressInterval,omitempty"`
+	HTTPTimeout            time.Duration `yaml:"httpTimeout,omitempty"`
+	ProxyURL               string        `yaml:"proxyURL,omitempty"`
+	InsecureSkipTLSVerify  bool          `yaml:"insecureSkipTLSVerify,omitempty"`
+	AlarmCommand           []string      `yaml:"alarmCommand,omitempty"`
+	PollInterval           time.Duration `yaml:"pollInterval,omitempty"`
+	ShutdownCommand        []string      `yaml:"shutdownCommand,omitempty"`
+	ShutdownDelay          time.Duration `yaml:"shutdownDelay,omitempty"`
+	AuthToken              string        `yaml:"authToken,omitempty"`
+	WebhookURLs            []string      `yaml:"webhookURLs,omitempty"`
+	MinShutdownSeverity    string        `yaml:"minShutdownSeverity,omitempty"`
+	InitiatorHost          string        `yaml:"initiatorHost,omitempty"`
+	InitiatorUser          string        `yaml:"initiatorUser,omitempty"`
+	MaxDownloadBytesPerSec int64         `yaml:"maxDownloadBytesPerSec,omitempty"`
+	KeepBackups            int           `yaml:"keepBackups,omitempty"`
+	PreUpdateCommand       []string      `yaml:"preUpdateCommand,omitempty"`
+	PostUpdateCommand      []string      `yaml:"postUpdateCommand,omitempty"`
+	MarkerPath             string        `yaml:"markerPath,omitempty"`
+	MarkerLifetime         time.Duration `yaml:"markerLifetime,omitempty"`
+	DialTimeout            time.Duration `yaml:"dialTimeout,omitempty"`
+	RequestTimeout         time.Duration `yaml:"requestTimeout,omitempty"`
+	TempDir                string        `yaml:"tempDir,omitempty"`
+	ManifestRetries        int           `yaml:"manifestRetries,omitempty"`
+	SkipUpdateIfOffline    bool          `yaml:"skipUpdateIfOffline,omitempty"`
+	StaleTempDirAge        time.Duration `yaml:"staleTempDirAge,omitempty"`
+	UpdateType             string        `yaml:"-"`
+
+	UpdateHTTPHeaders map[string]string `yaml:"updateHTTPHeaders,omitempty"`
+	InstallRoots      []string          `yaml:"installRoots,omitempty"`
+}
+
+func GetSettingsFileName() string {
+	settingsFileName := os.Getenv(SettingsFileEnvironmentVariable)
+	if settingsFileName == "" {
+		return SettingsFileName
+	}
+	return settingsFileName
 }
 
 func ReadCommonSettingsFromFile() error {
-	_, err := os.Stat(SettingsFileName)
+	return ReadCommonSettingsFromPath(GetSettingsFileName())
+}
+
+func ReadCommonSettingsFromPath(settingsFileName string) error {
+	if settingsFileName == StandardInputFileName {
+		return ReadCommonSettingsFromReader(os.Stdin)
+	}
+	_, err := os.Stat(settingsFileName)
 	if err != nil {
 		return err
-	} else {
-		data, err := os.ReadFile(SettingsFileName)
+	}
+	data, err := os.ReadFile(settingsFileName)
+	if err != nil {
+		return err
+	}
+	return parseCommonSettings(data)
+}
+
+func ReadCommonSettingsFromReader(reader io.Reader) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	return parseCommonSettings(data)
+}
+
+func parseCommonSettings(data []byte) error {
+	settings, err := decodeCommonSettings(data)
+	if err != nil {
+		return err
+	}
+	Settings = settings
+	activeSettings.Store(settings)
+	return nil
+}
+
+// newDefaultCommonSettings returns the settings that are used for the keys missing
+// from the settings file, so an explicit 0 in the file is kept: no download or
+// update description retries, no download progress logs, no stale directory cleanup.
+func newDefaultCommonSettings() *CommonSettings {
+	return &CommonSettings{
+		DownloadConcurrency: DefaultDownloadConcurrency,
+		DownloadRetries:     DefaultDownloadRetries,
+		ManifestRetries:     DefaultManifestRetries,
+		StaleTempDirAge:     DefaultStaleTempDirAge,
+		ProgressInterval:    DefaultProgressInterval,
+		RequestTimeout:      DefaultRequestTimeout,
+	}
+}
+
+func decodeCommonSettings(data []byte) (*CommonSettings, error) {
+	settings := newDefaultCommonSettings()
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err := decoder.Decode(&settings)
+	if errors.Is(err, io.EOF) {
+		settings = nil
+	} else if err != nil {
+		return nil, err
+	}
+	if settings == nil {
+		return nil, errors.New("the settings are empty")
+	}
+	err = ValidateUpdateFolder(settings.ServerUpdateFolder)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URI of updates folder, %s", err.Error())
+	}
+	serverSockets := settings.GetServerSockets()
+	if len(serverSockets) == 0 {
+		return nil, errors.New("server address is not set")
+	}
+	for _, serverSocket := range serverSockets {
+		err = ValidateServerAddress(serverSocket)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("invalid server address, %s", err.Error())
 		}
-		err = yaml.Unmarshal(data, &Settings)
+	}
+	if settings.DownloadConcurrency < 1 {
+		return nil, errors.New("download concurrency must be at least 1")
+	}
+	if settings.DownloadRetries < 0 {
+		return nil, errors.New("number of download retries can't be negative")
+	}
+	if settings.ManifestRetries < 0 {
+		return nil, errors.New("number of update description retries can't be negative")
+	}
+	if settings.StaleTempDirAge < 0 {
+		return nil, errors.New("stale temporary directory age can't be negative")
+	}
+	if settings.ProgressInterval < 0 {
+		return nil, errors.New("download progress interval can't be negative")
+	}
+	if settings.HTTPTimeout < 0 {
+		return nil, errors.New("HTTP timeout can't be negative")
+	}
+	if settings.HTTPTimeout == 0 {
+		settings.HTTPTimeout = DefaultHTTPTimeout
+	}
+	if settings.DialTimeout < 0 {
+		return nil, errors.New("dial timeout can't be negative")
+	}
+	if settings.RequestTimeout < 0 {
+		return nil, errors.New("request timeout can't be negative")
+	}
+	if settings.MarkerLifetime < 0 {
+		return nil, errors.New("update marker lifetime can't be negative")
+	}
+	if settings.KeepBackups < 0 {
+		return nil, errors.New("number of backups to keep can't be negative")
+	}
+	if settings.MaxDownloadBytesPerSec < 0 {
+		return nil, errors.New("download bandwidth limit can't be negative")
+	}
+	if settings.ShutdownDelay < 0 {
+		return nil, errors.New("shutdown delay can't be negative")
+	}
+	if settings.ProxyURL != "" {
+		_, err = url.ParseRequestURI(settings.ProxyURL)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("invalid proxy URI, %s", err.Error())
 		}
 	}
-	_, err = url.ParseRequestURI(Settings.ServerUpdateFolder)
+	if settings.MinShutdownSeverity == "" {
+		settings.MinShutdownSeverity = CriticalSeverity
+	}
+	err = ValidateSeverity(settings.MinShutdownSeverity)
 	if err != nil {
-		return fmt.Errorf("invalid URI of updates folder, %s", err.Error())
+		return nil, fmt.Errorf("invalid minimum shutdown severity, %s", err.Error())
+	}
+	for _, webhookURL := range settings.WebhookURLs {
+		_, err = url.ParseRequestURI(webhookURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid webhook URI, %s", err.Error())
+		}
+	}
+	for headerName, headerValue := range settings.UpdateHTTPHeaders {
+		if headerName == "" || strings.ContainsAny(headerName, " \t\r\n:") {
+			return nil, fmt.Errorf("invalid HTTP header name %q", headerName)
+		}
+		if strings.ContainsAny(headerValue, "\r\n") {
+			return nil, fmt.Errorf("invalid value of the HTTP header %s", headerName)
+		}
+	}
+	for i, installRoot := range settings.InstallRoots {
+		if !filepath.IsAbs(installRoot) {
+			return nil, fmt.Errorf("the install root %s is not an absolute path", installRoot)
+		}
+		settings.InstallRoots[i] = filepath.Clean(installRoot)
+	}
+	return settings, nil
+}
+
+func (settings *CommonSettings) String() string {
+	webhookURLs := make([]string, 0, len(settings.WebhookURLs))
+	for _, webhookURL := range settings.WebhookURLs {
+		webhookURLs = append(webhookURLs, redactURL(webhookURL))
+	}
+	authToken := ""
+	if settings.AuthToken != "" {
+		authToken = "[redacted]"
+	}
+	headerNames := make([]string, 0, len(settings.UpdateHTTPHeaders))
+	for headerName := range settings.UpdateHTTPHeaders {
+		headerNames = append(headerNames, headerName)
+	}
+	sort.Strings(headerNames)
+	updateHTTPHeaders := make([]string, 0, len(headerNames))
+	for _, headerName := range headerNames {
+		updateHTTPHeaders = append(updateHTTPHeaders,
+			fmt.Sprintf("%s: %s", headerName, redactHeader(headerName, settings.UpdateHTTPHeaders[headerName])))
+	}
+	return fmt.Sprintf("server addresses: %s, updates folder: %s, HTTP timeout: %s, proxy: %s, "+
+		"poll interval: %s, shutdown delay: %s, minimum shutdown severity: %s, auth token: %s, webhooks: %s, "+
+		"update HTTP headers: %s",
+		strings.Join(settings.GetServerSockets(), ", "),
+		redactURL(settings.ServerUpdateFolder),
+		settings.HTTPTimeout,
+		redactURL(settings.ProxyURL),
+		settings.PollInterval,
+		settings.ShutdownDelay,
+		settings.MinShutdownSeverity,
+		authToken,
+		strings.Join(webhookURLs, ", "),
+		strings.Join(updateHTTPHeaders, ", "))
+}
+
+func redactHeader(headerName string, headerValue string) string {
+	lowerHeaderName := strings.ToLower(headerName)
+	for _, secretMarker := range []string{"auth", "token", "key", "secret", "password", "cookie", "signature"} {
+		if strings.Contains(lowerHeaderName, secretMarker) {
+			return "[redacted]"
+		}
 	}
-	_, err = net.ResolveTCPAddr("tcp", Settings.ServerSocket)
+	return headerValue
+}
+
+func redactURL(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
 	if err != nil {
-		return fmt.Errorf("invalid server address, %s", err.Error())
+		return "[invalid URI]"
 	}
-	return nil
+	if parsedURL.RawQuery != "" {
+		parsedURL.RawQuery = "[redacted]"
+	}
+	return parsedURL.Redacted()
+}
+
+func (settings *CommonSettings) GetServerSockets() []string {
+	serverSockets := make([]string, 0, len(settings.ServerSockets)+1)
+	isSocketAdded := make(map[string]bool, len(settings.ServerSockets)+1)
+	for _, serverSocket := range append([]string{settings.ServerSocket}, settings.ServerSockets...) {
+		if serverSocket == "" || isSocketAdded[serverSocket] {
+			continue
+		}
+		isSocketAdded[serverSocket] = true
+		serverSockets = append(serverSockets, serverSocket)
+	}
+	return serverSockets
 }
 
 func ReadCommonSettingsFromArgs() error {
@@ -96,14 +415,14 @@ func ReadCommonSettingsFromArgs() error {
 	if len(flag.Args()) == 2 {
 		serverUpdateFolder = flag.Arg(0)
 		serverSocket = flag.Arg(1)
-		_, err := url.ParseRequestURI(serverUpdateFolder)
+		err := ValidateUpdateFolder(serverUpdateFolder)
 		if err != nil {
 			parsingError = fmt.Errorf("invalid URI of updates folder, %s", err.Error())
 		} else {
 			parsingError = nil
 		}
 		if parsingError == nil {
-			_, err := net.ResolveTCPAddr("tcp", serverSocket)
+			err := ValidateServerAddress(serverSocket)
 			if err != nil {
 				parsingError = fmt.Errorf("invalid server address, %s", err.Error())
 			} else {
@@ -136,20 +455,278 @@ func SaveCommonSettingsToFile() error {
 	return nil
 }
 
+func NewHTTPClient(settings *CommonSettings) (*http.Client, error) {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   httpDialTimeout,
+			KeepAlive: httpKeepAlive,
+		}).DialContext,
+		MaxIdleConns:          httpMaxIdleConnections,
+		MaxIdleConnsPerHost:   settings.DownloadConcurrency,
+		IdleConnTimeout:       httpIdleConnectionTimeout,
+		TLSHandshakeTimeout:   httpDialTimeout,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: settings.InsecureSkipTLSVerify,
+		},
+	}
+	if settings.ProxyURL != "" {
+		proxyURL, err := url.Parse(settings.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URI, %s", err.Error())
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	timeout := settings.HTTPTimeout
+	if timeout == 0 {
+		timeout = DefaultHTTPTimeout
+	}
+	// The timeout limits waiting for the response headers and every stall while reading
+	// the body, not the whole transfer, so large packages can take as long as they need.
+	transport.ResponseHeaderTimeout = timeout
+	return &http.Client{
+		Transport: &idleTimeoutTransport{transport: transport, timeout: timeout},
+	}, nil
+}
+
+type RoleDefinitions struct {
+	Roles       map[string][]string `yaml:"roles"`
+	Executables map[string]string   `yaml:"executables"`
+	Paths       map[string]string   `yaml:"paths,omitempty"`
+}
+
+func ReadRoleDefinitionsFromFile() (*RoleDefinitions, error) {
+	data, err := os.ReadFile(RolesFileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	roleDefinitions := &RoleDefinitions{}
+	err = yaml.Unmarshal(data, roleDefinitions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid role definitions in %s, %s", RolesFileName, err.Error())
+	}
+	return roleDefinitions, nil
+}
+
 type UpdateDescription struct {
-	VersionNumber string              `yaml:"version"`
-	Files         map[string]string   `yaml:"files"`
-	Roles         map[string][]string `yaml:"roles"`
-	Executables   map[string]string   `yaml:"executables"`
+	VersionNumber   string              `yaml:"version"`
+	Files           map[string]string   `yaml:"files"`
+	Roles           map[string][]string `yaml:"roles"`
+	Executables     map[string]string   `yaml:"executables"`
+	Compression     map[string]string   `yaml:"compression,omitempty"`
+	CompressedFiles map[string]string   `yaml:"compressedFiles,omitempty"`
+	HashAlgorithm   string              `yaml:"hashAlgorithm,omitempty"`
+	ManifestVersion int                 `yaml:"manifestVersion,omitempty"`
+	Paths           map[string]string   `yaml:"paths,omitempty"`
+	ProbeVersion    bool                `yaml:"probeVersion,omitempty"`
 }
 
 func NewUpdateDescription() *UpdateDescription {
 	return &UpdateDescription{
-		VersionNumber: CurrentVersion,
-		Files:         make(map[string]string, 16),
-		Roles:         make(map[string][]string, 16),
-		Executables:   make(map[string]string, 16),
+		VersionNumber:   CurrentVersion,
+		Files:           make(map[string]string, 16),
+		Roles:           make(map[string][]string, 16),
+		Executables:     make(map[string]string, 16),
+		Compression:     make(map[string]string, 16),
+		CompressedFiles: make(map[string]string, 16),
+		HashAlgorithm:   SHA512HashAlgorithm,
+		ManifestVersion: CurrentManifestVersion,
+		Paths:           make(map[string]string, 16),
+	}
+}
+
+func (updateDescription *UpdateDescription) CheckManifestVersion() error {
+	manifestVersion := updateDescription.ManifestVersion
+	if manifestVersion == 0 {
+		manifestVersion = 1
+	}
+	if manifestVersion > CurrentManifestVersion {
+		return fmt.Errorf("the update description has the manifest version %d, "+
+			"but this program supports only version %d and older, please update the updater first",
+			manifestVersion, CurrentManifestVersion)
+	}
+	return nil
+}
+
+func (updateDescription *UpdateDescription) GetChecksumFunction() (crypto.Hash, error) {
+	return GetChecksumFunction(updateDescription.HashAlgorithm)
+}
+
+func (updateDescription *UpdateDescription) GetRemoteFileName(fileName string) (string, error) {
+	compression, isCompressed := updateDescription.Compression[fileName]
+	if !isCompressed {
+		return fileName, nil
+	}
+	if compression != GzipCompression {
+		return "", fmt.Errorf("the compression %s of the file %s is not supported", compression, fileName)
+	}
+	return fileName + GzipFileExtension, nil
+}
+
+func (updateDescription *UpdateDescription) GetTargetPath(fileName string) string {
+	targetPath := updateDescription.Paths[fileName]
+	if targetPath == "" {
+		return fileName
+	}
+	return targetPath
+}
+
+func (updateDescription *UpdateDescription) GetRoleFiles(userRole string) ([]string, error) {
+	files, isRoleFound := updateDescription.Roles[userRole]
+	if !isRoleFound {
+		availableRoles := make([]string, 0, len(updateDescription.Roles))
+		for availableRole := range updateDescription.Roles {
+			availableRoles = append(availableRoles, availableRole)
+		}
+		sort.Strings(availableRoles)
+		return nil, fmt.Errorf("the user role %s is not described in the update description, available roles: %s",
+			userRole, strings.Join(availableRoles, ", "))
+	}
+	missingFiles := make([]string, 0)
+	for _, fileName := range files {
+		if _, isChecksumFound := updateDescription.Files[fileName]; !isChecksumFound {
+			missingFiles = append(missingFiles, fileName)
+		}
+	}
+	if len(missingFiles) > 0 {
+		return nil, fmt.Errorf("the update description has no checksums for the files of the user role %s: %s",
+			userRole, strings.Join(missingFiles, ", "))
+	}
+	return files, nil
+}
+
+func (updateDescription *UpdateDescription) Validate() error {
+	userRoles := make([]string, 0, len(updateDescription.Roles))
+	for userRole := range updateDescription.Roles {
+		userRoles = append(userRoles, userRole)
+	}
+	sort.Strings(userRoles)
+	usedFiles := make(map[string]bool, len(updateDescription.Files))
+	for _, userRole := range userRoles {
+		_, err := updateDescription.GetRoleFiles(userRole)
+		if err != nil {
+			return err
+		}
+		for _, fileName := range updateDescription.Roles[userRole] {
+			usedFiles[fileName] = true
+		}
+	}
+	executableRoles := make([]string, 0, len(updateDescription.Executables))
+	for userRole := range updateDescription.Executables {
+		executableRoles = append(executableRoles, userRole)
+	}
+	sort.Strings(executableRoles)
+	for _, userRole := range executableRoles {
+		executable := updateDescription.Executables[userRole]
+		files, isRoleFound := updateDescription.Roles[userRole]
+		if !isRoleFound {
+			return fmt.Errorf("the executable %s is set for the user role %s, which has no files", executable, userRole)
+		}
+		isExecutableFound := false
+		for _, fileName := range files {
+			if fileName == executable {
+				isExecutableFound = true
+				break
+			}
+		}
+		if !isExecutableFound {
+			return fmt.Errorf("the executable %s of the user role %s is not in the files of this role", executable, userRole)
+		}
+	}
+	orphanedFiles := make([]string, 0)
+	for fileName := range updateDescription.Files {
+		if !usedFiles[fileName] {
+			orphanedFiles = append(orphanedFiles, fileName)
+		}
+	}
+	if len(orphanedFiles) > 0 {
+		sort.Strings(orphanedFiles)
+		return fmt.Errorf("the files are not used by any user role: %s", strings.Join(orphanedFiles, ", "))
+	}
+	return updateDescription.ValidatePaths()
+}
+
+// ValidatePaths checks the file names and install paths, which come from the update
+// server and are used as write targets: file names must be relative and no path may
+// contain ".." segments.
+func (updateDescription *UpdateDescription) ValidatePaths() error {
+	for fileName := range updateDescription.Files {
+		err := validateCleanPath(fileName)
+		if err != nil {
+			return fmt.Errorf("invalid file name, %s", err.Error())
+		}
+		if isAbsolutePath(fileName) {
+			return fmt.Errorf("the file name %s is not a relative path", fileName)
+		}
+	}
+	for fileName, targetPath := range updateDescription.Paths {
+		if _, isChecksumFound := updateDescription.Files[fileName]; !isChecksumFound {
+			return fmt.Errorf("the install path %s is set for the unknown file %s", targetPath, fileName)
+		}
+		if targetPath == "" {
+			return fmt.Errorf("the install path of the file %s is empty", fileName)
+		}
+		err := validateCleanPath(targetPath)
+		if err != nil {
+			return fmt.Errorf("invalid install path of the file %s, %s", fileName, err.Error())
+		}
 	}
+	return nil
+}
+
+// ValidateInstallRoots checks that every absolute install path is inside one of the
+// locally configured roots. Relative paths stay inside the working directory.
+func (updateDescription *UpdateDescription) ValidateInstallRoots(installRoots []string) error {
+	for fileName, targetPath := range updateDescription.Paths {
+		if !isAbsolutePath(targetPath) {
+			continue
+		}
+		if !isPathWithinRoots(targetPath, installRoots) {
+			return fmt.Errorf("the install path %s of the file %s is outside of the install roots from the settings",
+				targetPath, fileName)
+		}
+	}
+	return nil
+}
+
+func validateCleanPath(checkedPath string) error {
+	normalizedPath := filepath.FromSlash(checkedPath)
+	if filepath.Clean(normalizedPath) != normalizedPath {
+		return fmt.Errorf("%s is not a clean path", checkedPath)
+	}
+	pathSegments := strings.FieldsFunc(checkedPath, func(character rune) bool {
+		return character == '/' || character == '\\'
+	})
+	for _, pathSegment := range pathSegments {
+		if pathSegment == ".." {
+			return fmt.Errorf("%s contains a parent directory reference", checkedPath)
+		}
+	}
+	return nil
+}
+
+func isAbsolutePath(checkedPath string) bool {
+	if filepath.IsAbs(checkedPath) || strings.HasPrefix(checkedPath, "/") || strings.HasPrefix(checkedPath, "\\") {
+		return true
+	}
+	return len(checkedPath) > 1 && checkedPath[1] == ':'
+}
+
+func isPathWithinRoots(targetPath string, installRoots []string) bool {
+	for _, installRoot := range installRoots {
+		relativePath, err := filepath.Rel(installRoot, filepath.FromSlash(targetPath))
+		if err != nil {
+			continue
+		}
+		if relativePath != ".." && !strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
 }
 
 type Serializable interface {
@@ -157,8 +734,10 @@ type Serializable interface {
 }
 
 type Message struct {
-	Type string           `json:"type" required:"true"`
-	Data *json.RawMessage `json:"data" required:"true"`
+	Type      string            `json:"type" required:"true"`
+	RequestID string            `json:"requestID,omitempty"`
+	Data      *json.RawMessage  `json:"data" required:"true"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
 }
 
 type InitiatorData struct {
@@ -167,39 +746,131 @@ type InitiatorData struct {
 }
 
 func NewInitiatorData() (*InitiatorData, error) {
-	hostName, err := os.Hostname()
-	if err != nil {
-		return nil, err
+	return NewInitiatorDataContext(context.Background())
+}
+
+func NewInitiatorDataContext(ctx context.Context) (*InitiatorData, error) {
+	if initiator, isInitiatorFound := ctx.Value(initiatorContextKey{}).(*InitiatorData); isInitiatorFound {
+		return initiator.Clone(), nil
 	}
-	user, err := user.Current()
-	if err != nil {
-		return nil, err
+	hostName := os.Getenv(InitiatorHostEnvironmentVariable)
+	if hostName == "" && Settings != nil {
+		hostName = Settings.InitiatorHost
+	}
+	userName := os.Getenv(InitiatorUserEnvironmentVariable)
+	if userName == "" && Settings != nil {
+		userName = Settings.InitiatorUser
+	}
+	if hostName == "" || userName == "" {
+		detectSystemInitiator()
+	}
+	if hostName == "" {
+		if systemInitiator.hostNameError != nil {
+			return nil, systemInitiator.hostNameError
+		}
+		hostName = systemInitiator.hostName
+	}
+	if userName == "" {
+		if systemInitiator.userNameError != nil {
+			return nil, systemInitiator.userNameError
+		}
+		userName = systemInitiator.userName
 	}
 	return &InitiatorData{
 		Host: hostName,
-		User: user.Username,
+		User: userName,
 	}, nil
 }
 
+func ContextWithInitiator(ctx context.Context, initiator *InitiatorData) context.Context {
+	return context.WithValue(ctx, initiatorContextKey{}, initiator)
+}
+
+func detectSystemInitiator() {
+	systemInitiatorOnce.Do(func() {
+		systemInitiator.hostName, systemInitiator.hostNameError = getHostName()
+		systemInitiator.userName, systemInitiator.userNameError = getUserName()
+	})
+}
+
+func (initiatorData *InitiatorData) Clone() *InitiatorData {
+	if initiatorData == nil {
+		return nil
+	}
+	clonedInitiator := *initiatorData
+	return &clonedInitiator
+}
+
+func (initiatorData *InitiatorData) Equal(other *InitiatorData) bool {
+	if initiatorData == nil || other == nil {
+		return initiatorData == other
+	}
+	return initiatorData.Host == other.Host && initiatorData.User == other.User
+}
+
 func (initiatorData *InitiatorData) String() string {
+	if initiatorData == nil {
+		return "unknown initiator"
+	}
 	return fmt.Sprintf("host: %v, user: %v", initiatorData.Host, initiatorData.User)
 }
 
 type AlarmRequest struct {
 	Initiator            *InitiatorData `json:"initiator" required:"true"`
 	IsAlarmButtonPressed bool           `json:"isAlarmButtonPressed" required:"true"`
+	Severity             string         `json:"severity,omitempty"`
+	Zone                 string         `json:"zone,omitempty"`
+	Reason               string         `json:"reason,omitempty"`
+	Token                string         `json:"token,omitempty"`
+	IdempotencyKey       string         `json:"idempotencyKey,omitempty"`
+	RequestID            string         `json:"-"`
 }
 
 func NewAlarmRequest(client *Client) *AlarmRequest {
-	return &AlarmRequest{Initiator: client.Initiator, IsAlarmButtonPressed: client.IsAlarmButtonPressed}
+	return &AlarmRequest{
+		Initiator:            client.Initiator,
+		IsAlarmButtonPressed: client.IsAlarmButtonPressed,
+		Severity:             client.Options.Severity,
+		Zone:                 client.Options.Zone,
+		Reason:               client.Options.Reason,
+		Token:                CurrentSettings().AuthToken,
+		IdempotencyKey:       NewRequestID(),
+		RequestID:            NewRequestID(),
+	}
+}
+
+func (alarmRequest *AlarmRequest) IsAuthorized(authToken string) bool {
+	if authToken == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(alarmRequest.Token), []byte(authToken)) == 1
+}
+
+func (alarmRequest *AlarmRequest) GetAlarmResponse(sequence uint64) *AlarmResponse {
+	return &AlarmResponse{
+		DateTime:             time.Now(),
+		Initiator:            alarmRequest.Initiator,
+		IsAlarmButtonPressed: alarmRequest.IsAlarmButtonPressed,
+		Severity:             alarmRequest.GetSeverity(),
+		Zone:                 alarmRequest.Zone,
+		Sequence:             sequence,
+	}
 }
 
-func (alarmRequest *AlarmRequest) GetAlarmResponse() *AlarmResponse {
-	return &AlarmResponse{DateTime: time.Now(), IsAlarmButtonPressed: alarmRequest.IsAlarmButtonPressed}
+func (alarmRequest *AlarmRequest) GetStateResponse(sequence uint64) *StateResponse {
+	stateResponse := NewStateResponse(alarmRequest.Initiator, alarmRequest.IsAlarmButtonPressed)
+	stateResponse.Severity = alarmRequest.GetSeverity()
+	stateResponse.Zone = alarmRequest.Zone
+	stateResponse.Reason = alarmRequest.Reason
+	stateResponse.Sequence = sequence
+	return stateResponse
 }
 
-func (alarmRequest *AlarmRequest) GetStateResponse() *StateResponse {
-	return NewStateResponse(alarmRequest.Initiator, alarmRequest.IsAlarmButtonPressed)
+func (alarmRequest *AlarmRequest) GetSeverity() string {
+	if alarmRequest.Severity == "" {
+		return CriticalSeverity
+	}
+	return alarmRequest.Severity
 }
 
 func (alarmRequest *AlarmRequest) String() string {
@@ -209,16 +880,109 @@ func (alarmRequest *AlarmRequest) String() string {
 	} else {
 		buttonPressed = "no"
 	}
-	return fmt.Sprintf("initiator: %v, button is pressed: %v", alarmRequest.Initiator.String(), buttonPressed)
+	return fmt.Sprintf("initiator: %v, button is pressed: %v, severity: %v, zone: %v, reason: %q",
+		alarmRequest.Initiator.String(), buttonPressed, alarmRequest.GetSeverity(), GetZoneName(alarmRequest.Zone),
+		alarmRequest.Reason)
 }
 
 func (alarmRequest *AlarmRequest) Serialize() ([]byte, error) {
-	return SerializeWithTypeName("AlarmRequest", alarmRequest)
+	return SerializeWithRequestID("AlarmRequest", alarmRequest.RequestID, alarmRequest)
+}
+
+type AlarmBatchRequest struct {
+	Requests       []*AlarmRequest `json:"requests" required:"true"`
+	Token          string          `json:"token,omitempty"`
+	IdempotencyKey string          `json:"idempotencyKey,omitempty"`
+	RequestID      string          `json:"-"`
+}
+
+func NewAlarmBatchRequest(client *Client) *AlarmBatchRequest {
+	alarmBatchRequest := &AlarmBatchRequest{
+		Requests:       make([]*AlarmRequest, 0, len(client.Options.Zones)),
+		Token:          CurrentSettings().AuthToken,
+		IdempotencyKey: NewRequestID(),
+		RequestID:      NewRequestID(),
+	}
+	for _, zone := range client.Options.Zones {
+		alarmRequest := NewAlarmRequest(client)
+		alarmRequest.Zone = zone
+		alarmRequest.Token = ""
+		alarmRequest.IdempotencyKey = ""
+		alarmRequest.RequestID = alarmBatchRequest.RequestID
+		alarmBatchRequest.Requests = append(alarmBatchRequest.Requests, alarmRequest)
+	}
+	return alarmBatchRequest
+}
+
+func (alarmBatchRequest *AlarmBatchRequest) IsAuthorized(authToken string) bool {
+	if authToken == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(alarmBatchRequest.Token), []byte(authToken)) == 1
+}
+
+func (alarmBatchRequest *AlarmBatchRequest) GetInitiator() *InitiatorData {
+	if len(alarmBatchRequest.Requests) == 0 || alarmBatchRequest.Requests[0] == nil {
+		return nil
+	}
+	return alarmBatchRequest.Requests[0].Initiator
+}
+
+func (alarmBatchRequest *AlarmBatchRequest) Validate() error {
+	if len(alarmBatchRequest.Requests) == 0 {
+		return errors.New("the batch has no alarm requests")
+	}
+	isZoneListed := make(map[string]bool, len(alarmBatchRequest.Requests))
+	for _, alarmRequest := range alarmBatchRequest.Requests {
+		if alarmRequest == nil {
+			return errors.New("the batch contains an empty alarm request")
+		}
+		if isZoneListed[alarmRequest.Zone] {
+			return fmt.Errorf("the zone %s is listed more than once", GetZoneName(alarmRequest.Zone))
+		}
+		isZoneListed[alarmRequest.Zone] = true
+	}
+	return nil
+}
+
+func (alarmBatchRequest *AlarmBatchRequest) String() string {
+	descriptions := make([]string, 0, len(alarmBatchRequest.Requests))
+	for _, alarmRequest := range alarmBatchRequest.Requests {
+		if alarmRequest != nil {
+			descriptions = append(descriptions, alarmRequest.String())
+		}
+	}
+	return "[" + strings.Join(descriptions, "; ") + "]"
+}
+
+func (alarmBatchRequest *AlarmBatchRequest) Serialize() ([]byte, error) {
+	return SerializeWithRequestID("AlarmBatchRequest", alarmBatchRequest.RequestID, alarmBatchRequest)
+}
+
+type AlarmBatchResponse struct {
+	Responses []*AlarmResponse `json:"responses" required:"true"`
+}
+
+func (alarmBatchResponse *AlarmBatchResponse) String() string {
+	descriptions := make([]string, 0, len(alarmBatchResponse.Responses))
+	for _, alarmResponse := range alarmBatchResponse.Responses {
+		descriptions = append(descriptions,
+			fmt.Sprintf("zone %s: %s", GetZoneName(alarmResponse.Zone), alarmResponse.String()))
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+func (alarmBatchResponse *AlarmBatchResponse) Serialize() ([]byte, error) {
+	return SerializeWithTypeName("AlarmBatchResponse", alarmBatchResponse)
 }
 
 type AlarmResponse struct {
-	DateTime             time.Time `json:"dateTime" required:"true"`
-	IsAlarmButtonPressed bool      `json:"isAlarmButtonPressed" required:"true"`
+	DateTime             time.Time      `json:"dateTime" required:"true"`
+	Initiator            *InitiatorData `json:"initiator"`
+	IsAlarmButtonPressed bool           `json:"isAlarmButtonPressed" required:"true"`
+	Severity             string         `json:"severity,omitempty"`
+	Zone                 string         `json:"zone,omitempty"`
+	Sequence             uint64         `json:"sequence"`
 }
 
 func (alarmResponse *AlarmResponse) String() string {
@@ -228,33 +992,135 @@ func (alarmResponse *AlarmResponse) String() string {
 	} else {
 		buttonPressed = "no"
 	}
-	return fmt.Sprintf("%v, button is pressed: %v", alarmResponse.DateTime.Format(time.RFC3339), buttonPressed)
+	return fmt.Sprintf("%v, button is pressed: %v, sequence: %v",
+		alarmResponse.DateTime.Format(time.RFC3339), buttonPressed, alarmResponse.Sequence)
 }
 
 func (alarmResponse *AlarmResponse) Serialize() ([]byte, error) {
 	return SerializeWithTypeName("AlarmResponse", alarmResponse)
 }
 
-type StateRequest struct {
-	Initiator *InitiatorData `json:"initiator" required:"true"`
+type ErrorResponse struct {
+	Code    string `json:"code" required:"true"`
+	Message string `json:"message" required:"true"`
 }
 
-func NewStateRequest(client *Client) *StateRequest {
-	return &StateRequest{Initiator: client.Initiator}
+func NewErrorResponse(code string, message string) *ErrorResponse {
+	return &ErrorResponse{Code: code, Message: message}
 }
 
-func (stateRequest *StateRequest) String() string {
-	return fmt.Sprintf("initiator: %v", stateRequest.Initiator.String())
+func (errorResponse *ErrorResponse) String() string {
+	return fmt.Sprintf("code: %v, message: %v", errorResponse.Code, errorResponse.Message)
+}
+
+func (errorResponse *ErrorResponse) Serialize() ([]byte, error) {
+	return SerializeWithTypeName("ErrorResponse", errorResponse)
+}
+
+type StateRequest struct {
+	Initiator *InitiatorData `json:"initiator" required:"true"`
+	Zone      string         `json:"zone,omitempty"`
+	RequestID string         `json:"-"`
+}
+
+func NewStateRequest(client *Client) *StateRequest {
+	return &StateRequest{Initiator: client.Initiator, Zone: client.Options.Zone, RequestID: NewRequestID()}
+}
+
+func (stateRequest *StateRequest) String() string {
+	return fmt.Sprintf("initiator: %v, zone: %v", stateRequest.Initiator.String(), GetZoneName(stateRequest.Zone))
 }
 
 func (stateRequest *StateRequest) Serialize() ([]byte, error) {
-	return SerializeWithTypeName("StateRequest", stateRequest)
+	return SerializeWithRequestID("StateRequest", stateRequest.RequestID, stateRequest)
+}
+
+type ServerInfoRequest struct {
+	Initiator *InitiatorData `json:"initiator" required:"true"`
+	RequestID string         `json:"-"`
+}
+
+func NewServerInfoRequest(client *Client) *ServerInfoRequest {
+	return &ServerInfoRequest{Initiator: client.Initiator, RequestID: NewRequestID()}
+}
+
+func (serverInfoRequest *ServerInfoRequest) String() string {
+	return fmt.Sprintf("initiator: %v", serverInfoRequest.Initiator.String())
+}
+
+func (serverInfoRequest *ServerInfoRequest) Serialize() ([]byte, error) {
+	return SerializeWithRequestID("ServerInfoRequest", serverInfoRequest.RequestID, serverInfoRequest)
+}
+
+type ServerInfoResponse struct {
+	Version         *VersionInfo `json:"version" required:"true"`
+	ProtocolVersion int          `json:"protocolVersion" required:"true"`
+}
+
+func NewServerInfoResponse() *ServerInfoResponse {
+	return &ServerInfoResponse{Version: GetVersionInfo(), ProtocolVersion: ProtocolVersion}
+}
+
+func (serverInfoResponse *ServerInfoResponse) String() string {
+	versionInfo := "unknown version"
+	if serverInfoResponse.Version != nil {
+		versionInfo = serverInfoResponse.Version.String()
+	}
+	return fmt.Sprintf("%s, protocol version: %d", versionInfo, serverInfoResponse.ProtocolVersion)
+}
+
+func (serverInfoResponse *ServerInfoResponse) Serialize() ([]byte, error) {
+	return SerializeWithTypeName("ServerInfoResponse", serverInfoResponse)
+}
+
+type ResetRequest struct {
+	Initiator *InitiatorData `json:"initiator" required:"true"`
+	Token     string         `json:"token,omitempty"`
+	RequestID string         `json:"-"`
+}
+
+func NewResetRequest(initiator *InitiatorData) *ResetRequest {
+	return &ResetRequest{Initiator: initiator, Token: CurrentSettings().AuthToken, RequestID: NewRequestID()}
+}
+
+func (resetRequest *ResetRequest) IsAuthorized(authToken string) bool {
+	if authToken == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(resetRequest.Token), []byte(authToken)) == 1
+}
+
+func (resetRequest *ResetRequest) String() string {
+	return fmt.Sprintf("initiator: %v", resetRequest.Initiator.String())
+}
+
+func (resetRequest *ResetRequest) Serialize() ([]byte, error) {
+	return SerializeWithRequestID("ResetRequest", resetRequest.RequestID, resetRequest)
+}
+
+type ResetResponse struct {
+	DateTime     time.Time `json:"dateTime" required:"true"`
+	ClearedZones int       `json:"clearedZones"`
+	Sequence     uint64    `json:"sequence"`
+}
+
+func (resetResponse *ResetResponse) String() string {
+	return fmt.Sprintf("%v, cleared zones: %d, sequence: %d",
+		resetResponse.DateTime.Format(time.RFC3339), resetResponse.ClearedZones, resetResponse.Sequence)
+}
+
+func (resetResponse *ResetResponse) Serialize() ([]byte, error) {
+	return SerializeWithTypeName("ResetResponse", resetResponse)
 }
 
 type StateResponse struct {
 	DateTime             time.Time      `json:"dateTime" required:"true"`
 	Initiator            *InitiatorData `json:"initiator" required:"true"`
 	IsAlarmButtonPressed bool           `json:"isAlarmButtonPressed" required:"true"`
+	Severity             string         `json:"severity,omitempty"`
+	Zone                 string         `json:"zone,omitempty"`
+	Reason               string         `json:"reason,omitempty"`
+	Sequence             uint64         `json:"sequence"`
 }
 
 func NewStateResponse(data *InitiatorData, buttonPressed bool) *StateResponse {
@@ -265,6 +1131,37 @@ func NewStateResponse(data *InitiatorData, buttonPressed bool) *StateResponse {
 	}
 }
 
+func (stateResponse *StateResponse) Validate() error {
+	if stateResponse.DateTime.IsZero() {
+		return errors.New("the state has no date and time")
+	}
+	if stateResponse.Severity != "" {
+		if err := ValidateSeverity(stateResponse.Severity); err != nil {
+			return err
+		}
+	}
+	if len(stateResponse.Reason) > MaxReasonLength {
+		return fmt.Errorf("the reason is longer than %d bytes", MaxReasonLength)
+	}
+	for _, character := range stateResponse.Reason {
+		if unicode.IsControl(character) {
+			return errors.New("the reason contains control characters")
+		}
+	}
+	if stateResponse.IsAlarmButtonPressed &&
+		(stateResponse.Initiator == nil || (stateResponse.Initiator.Host == "" && stateResponse.Initiator.User == "")) {
+		return errors.New("the alarm button is pressed, but the initiator is unknown")
+	}
+	return nil
+}
+
+// Clone returns a deep copy of the state, the initiator of the copy is not shared.
+func (stateResponse *StateResponse) Clone() *StateResponse {
+	clonedState := *stateResponse
+	clonedState.Initiator = stateResponse.Initiator.Clone()
+	return &clonedState
+}
+
 func (stateResponse *StateResponse) String() string {
 	var buttonPressed string
 	if stateResponse.IsAlarmButtonPressed {
@@ -272,62 +1169,181 @@ func (stateResponse *StateResponse) String() string {
 	} else {
 		buttonPressed = "no"
 	}
-	return fmt.Sprintf("%v, initiator: %v, button is pressed: %v",
+	return fmt.Sprintf("%v, initiator: %v, button is pressed: %v, severity: %v, zone: %v, reason: %q, sequence: %v",
 		stateResponse.DateTime.Format(time.RFC3339),
 		stateResponse.Initiator.String(),
-		buttonPressed)
+		buttonPressed,
+		stateResponse.GetSeverity(),
+		GetZoneName(stateResponse.Zone),
+		stateResponse.Reason,
+		stateResponse.Sequence)
+}
+
+func GetZoneName(zone string) string {
+	if zone == "" {
+		return "default"
+	}
+	return zone
+}
+
+func (stateResponse *StateResponse) GetSeverity() string {
+	if stateResponse.Severity == "" {
+		return CriticalSeverity
+	}
+	return stateResponse.Severity
 }
 
 func (stateResponse *StateResponse) Serialize() ([]byte, error) {
 	return SerializeWithTypeName("StateResponse", stateResponse)
 }
 
+type StateChange struct {
+	Previous *StateResponse
+	Current  *StateResponse
+	Actor    *InitiatorData
+	DateTime time.Time
+}
+
+func NewStateChange(previous *StateResponse, current *StateResponse, actor *InitiatorData) *StateChange {
+	return &StateChange{
+		Previous: previous,
+		Current:  current,
+		Actor:    actor,
+		DateTime: current.DateTime,
+	}
+}
+
+func (stateChange *StateChange) IsToggle() bool {
+	return stateChange.Previous.IsAlarmButtonPressed != stateChange.Current.IsAlarmButtonPressed
+}
+
+func (stateChange *StateChange) String() string {
+	return fmt.Sprintf("%v, zone: %v, actor: %v, button is pressed: %v -> %v, sequence: %v",
+		stateChange.DateTime.Format(time.RFC3339),
+		GetZoneName(stateChange.Current.Zone),
+		stateChange.Actor.String(),
+		stateChange.Previous.IsAlarmButtonPressed,
+		stateChange.Current.IsAlarmButtonPressed,
+		stateChange.Current.Sequence)
+}
+
+type ClientOptions struct {
+	DebugMode        bool
+	Action           string
+	PollInterval     time.Duration
+	MaxRetryDuration time.Duration
+	ShutdownDelay    time.Duration
+	Severity         string
+	Zone             string
+	Zones            []string
+	Reason           string
+	LogSampling      int
+	MinSeverity      string
+	GracePrompt      time.Duration
+	Once             bool
+	ServerAddress    string
+
+	OnBlockedShutdown string
+	isPollIntervalSet bool
+}
+
 type Client struct {
 	Initiator            *InitiatorData
 	OperatingSystem      string
 	IsAlarmButtonPressed bool
+	Options              *ClientOptions
 	InfoLog              *log.Logger
 	ErrorLog             *log.Logger
 	interruptChannel     chan os.Signal
-	debugMode            bool
+	isAlarmReported      bool
+	serverSocketIndex    int
+	isServerSocketKnown  bool
+	isStateReceived      bool
+	pollCount            int
+	cancelShutdown       context.CancelFunc
+	shutdownMutex        sync.Mutex
+	inFlightCalls        sync.WaitGroup
+	callMutex            sync.Mutex
+	isClosing            bool
+	metadata             map[string]string
+	actedStates          actedStateCache
+	commandRunner        CommandRunner
 }
 
 func NewClient() (*Client, error) {
+	return NewClientWithLogOutput(os.Stdout)
+}
+
+func NewClientWithLogOutput(infoLogOutput io.Writer) (*Client, error) {
 	client := Client{
 		Initiator:        nil,
 		OperatingSystem:  runtime.GOOS,
-		InfoLog:          log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime),
+		InfoLog:          log.New(infoLogOutput, "INFO\t", log.Ldate|log.Ltime),
 		ErrorLog:         log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile),
 		interruptChannel: make(chan os.Signal, 1),
-	}
-	signal.Notify(client.interruptChannel, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-client.interruptChannel
-		client.Stop(false, 1)
-	}()
-	isUpdaterRunningNow := IsUpdaterRunningNow(client.InfoLog, client.ErrorLog)
-	if isUpdaterRunningNow {
-		return &client, errors.New("the updater is running now")
+		metadata:         map[string]string{VersionMetadataKey: CurrentVersion},
 	}
 	err := ReadCommonSettingsFromFile()
 	if err != nil {
 		return &client, err
 	}
+	isUpdaterRunningNow := IsUpdaterRunningNow(client.InfoLog, client.ErrorLog)
+	if isUpdaterRunningNow {
+		return &client, errors.New("the updater is running now")
+	}
 	initiatorData, err := NewInitiatorData()
 	if err != nil {
 		return &client, err
 	}
 	client.Initiator = initiatorData
-	debugMode, err := parseClientArgs()
+	options, err := parseClientArgs()
 	if err != nil {
 		return &client, err
 	}
-	client.debugMode = debugMode
+	client.Options = options
+	if client.Options.DebugMode {
+		client.InfoLog.Println("Settings:", Settings.String())
+	}
+	isAlarmCommandRequired := client.Options.Action == CommandAction ||
+		client.Options.OnBlockedShutdown == CommandBlockedShutdown
+	if isAlarmCommandRequired && len(Settings.AlarmCommand) == 0 {
+		return &client, errors.New("the alarm command is not set in the settings")
+	}
 	return &client, nil
 }
 
-func parseClientArgs() (bool, error) {
+func parseClientArgs() (*ClientOptions, error) {
 	debugModePointer := flag.Bool("debug", false, "debug mode (PC does not turn off)")
+	actionPointer := flag.String("action", ShutdownAction,
+		"what to do when the alarm button is pressed: shutdown, notify or command")
+	pollIntervalPointer := flag.Duration("interval", 0,
+		fmt.Sprintf("interval between requests to the server (default %s)", DefaultPollInterval))
+	maxRetryDurationPointer := flag.Duration("max-retry-duration", 0,
+		"give up sending the alarm request after this duration (0 means retry forever)")
+	shutdownDelayPointer := flag.Duration("shutdown-delay", 0,
+		"delay before the PC is turned off, rounded up to whole minutes on Linux and macOS "+
+			"(default is taken from the settings, 0 means immediately)")
+	severityPointer := flag.String("severity", CriticalSeverity,
+		"severity of the alarm sent to the server: info, warning or critical")
+	zones := make(zoneList, 0, 1)
+	flag.Var(&zones, "zone",
+		"alarm zone, can be repeated to switch several zones at once (the default zone is used if not set)")
+	reasonPointer := flag.String("reason", "", "reason for pressing or releasing the alarm button, for the audit log")
+	minSeverityPointer := flag.String("min-severity", "",
+		"minimum alarm severity that turns off the PC (default is taken from the settings)")
+	gracePromptPointer := flag.Duration("grace-prompt", 0,
+		"show a countdown of this duration that can be cancelled with Ctrl+C before the PC is turned off "+
+			"(only in an interactive console)")
+	oncePointer := flag.Bool("once", false,
+		fmt.Sprintf("check the alarm state once and exit (exit code 0 means released, %d means pressed)",
+			AlarmPressedExitCode))
+	logSamplingPointer := flag.Int("log-sampling", 0,
+		"log only every Nth status check while the state doesn't change (0 logs every check, changes are always logged)")
+	serverAddressPointer := flag.String("server-address", "",
+		"server address to use instead of the addresses from the settings, host:port or unix:///path/to.sock")
+	onBlockedShutdownPointer := flag.String("on-blocked-shutdown", LogBlockedShutdown,
+		fmt.Sprintf("what to do when the alarm is pressed but its severity doesn't allow turning off the PC: "+
+			"log, exit (with exit code %d) or command", ShutdownBlockedExitCode))
 	flag.Parse()
 	var err error
 	if len(flag.Args()) > 0 {
@@ -335,31 +1351,237 @@ func parseClientArgs() (bool, error) {
 	} else {
 		err = nil
 	}
-	return *debugModePointer, err
+	options := &ClientOptions{
+		DebugMode:        *debugModePointer,
+		Action:           *actionPointer,
+		PollInterval:     *pollIntervalPointer,
+		MaxRetryDuration: *maxRetryDurationPointer,
+		ShutdownDelay:    *shutdownDelayPointer,
+		Severity:         *severityPointer,
+		Zones:            zones,
+		Reason:           *reasonPointer,
+		LogSampling:      *logSamplingPointer,
+		MinSeverity:      *minSeverityPointer,
+		GracePrompt:      *gracePromptPointer,
+		Once:             *oncePointer,
+		ServerAddress:    *serverAddressPointer,
+
+		OnBlockedShutdown: *onBlockedShutdownPointer,
+		isPollIntervalSet: IsFlagSet(flag.CommandLine, "interval"),
+	}
+	if len(options.Zones) > 0 {
+		options.Zone = options.Zones[0]
+	}
+	settings := Settings
+	if settings == nil {
+		settings = &CommonSettings{}
+	}
+	options.MinSeverity = ResolveString(options.MinSeverity, settings.MinShutdownSeverity, CriticalSeverity)
+	options.ShutdownDelay = ResolveDuration(IsFlagSet(flag.CommandLine, "shutdown-delay"),
+		options.ShutdownDelay, settings.ShutdownDelay, 0)
+	options.PollInterval = ResolveDuration(options.isPollIntervalSet,
+		options.PollInterval, settings.PollInterval, DefaultPollInterval)
+	if err == nil && options.ServerAddress != "" {
+		err = ValidateServerAddress(options.ServerAddress)
+		if err != nil {
+			err = fmt.Errorf("invalid server address, %s", err.Error())
+		}
+	}
+	if err == nil && Settings != nil {
+		options.applyServerAddress(Settings)
+	}
+	if err == nil && options.ShutdownDelay < 0 {
+		err = errors.New("the shutdown delay can't be negative")
+	}
+	if err == nil && options.MaxRetryDuration < 0 {
+		err = errors.New("the maximum retry duration can't be negative")
+	}
+	if err == nil && options.LogSampling < 0 {
+		err = errors.New("the log sampling rate can't be negative")
+	}
+	if err == nil && options.PollInterval < MinPollInterval {
+		err = fmt.Errorf("the poll interval must be at least %s", MinPollInterval)
+	}
+	if err == nil {
+		err = ValidateSeverity(options.Severity)
+	}
+	if err == nil && options.MinSeverity != "" {
+		err = ValidateSeverity(options.MinSeverity)
+	}
+	if err == nil && options.GracePrompt < 0 {
+		err = errors.New("the grace prompt duration can't be negative")
+	}
+	if err == nil {
+		switch options.Action {
+		case ShutdownAction, NotifyAction, CommandAction:
+		default:
+			err = fmt.Errorf("unknown action %s", options.Action)
+		}
+	}
+	if err == nil {
+		switch options.OnBlockedShutdown {
+		case LogBlockedShutdown, ExitBlockedShutdown, CommandBlockedShutdown:
+		default:
+			err = fmt.Errorf("unknown blocked shutdown behavior %s", options.OnBlockedShutdown)
+		}
+	}
+	return options, err
 }
 
-func (client *Client) RunChecker() {
-	request, err := NewStateRequest(client).Serialize()
-	if err != nil {
-		client.ErrorLog.Println("Error while converting data:", err.Error())
-		client.Stop(false, 1)
+func (options *ClientOptions) applyServerAddress(settings *CommonSettings) {
+	if options.ServerAddress == "" {
+		return
+	}
+	settings.ServerSocket = ResolveServerAddress(settings.ServerSocket, options.ServerAddress)
+	settings.ServerSockets = nil
+}
+
+type zoneList []string
+
+func (zones *zoneList) String() string {
+	return strings.Join(*zones, ",")
+}
+
+func (zones *zoneList) Set(zone string) error {
+	*zones = append(*zones, zone)
+	return nil
+}
+
+func (client *Client) WithMetadata(metadata map[string]string) *Client {
+	for key, value := range metadata {
+		client.metadata[key] = value
+	}
+	return client
+}
+
+func (client *Client) HandleReload() {
+	HandleReloadSignal(client.InfoLog, client.ErrorLog,
+		func(previous *CommonSettings, current *CommonSettings) []string {
+			client.Options.applyServerAddress(current)
+			return nil
+		})
+}
+
+func (client *Client) getPollInterval() time.Duration {
+	pollInterval := ResolveDuration(client.Options.isPollIntervalSet,
+		client.Options.PollInterval, CurrentSettings().PollInterval, DefaultPollInterval)
+	if pollInterval < MinPollInterval {
+		return MinPollInterval
+	}
+	return pollInterval
+}
+
+func (client *Client) HandleInterrupts() {
+	signal.Notify(client.interruptChannel, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		interruptSignal := <-client.interruptChannel
+		for client.cancelPendingShutdown() {
+			interruptSignal = <-client.interruptChannel
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), clientDrainTimeout)
+		err := client.Shutdown(ctx)
+		cancel()
+		if err != nil {
+			client.ErrorLog.Println("Error while stopping the client:", err.Error())
+			client.Stop(false, 1)
+		}
+		client.Stop(false, GetInterruptExitCode(interruptSignal))
+	}()
+}
+
+func (client *Client) RunAsService(name string, run func()) error {
+	return RunAsService(name, client.interruptChannel, client.ErrorLog, run)
+}
+
+func (client *Client) RunChecker() error {
+	client.checkServerProtocol()
+	if client.Options.Once {
+		return client.runCheckerOnce()
 	}
 	for {
-		client.InfoLog.Println("Trying to send an alarm status request to the server")
-		client.sendToServer(request)
+		stateRequest := NewStateRequest(client)
+		request, err := stateRequest.Serialize()
+		if err != nil {
+			return fmt.Errorf("unable to convert data, %s", err.Error())
+		}
+		client.pollCount++
+		if client.isPollLogged() {
+			client.InfoLog.Println("Trying to send an alarm status request to the server, request ID:",
+				stateRequest.RequestID)
+		}
+		_, err = client.sendToServer(request)
+		if errors.Is(err, errRunFinished) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		time.Sleep(client.getPollInterval())
+	}
+}
+
+func (client *Client) runCheckerOnce() error {
+	stateResponse, err := client.QueryState()
+	if err != nil {
+		return fmt.Errorf("unable to request the alarm state, %s", err.Error())
+	}
+	client.InfoLog.Println("Status check response received:", stateResponse.String())
+	client.IsAlarmButtonPressed = stateResponse.IsAlarmButtonPressed
+	err = client.processAlarmButtonState(stateResponse)
+	if errors.Is(err, errRunFinished) {
+		return nil
 	}
+	if err != nil {
+		return err
+	}
+	if client.IsAlarmButtonPressed {
+		return ErrAlarmPressed
+	}
+	return nil
 }
 
-func (client *Client) RunAlarmer(IsAlarmButtonPressed bool) {
+func (client *Client) RunAlarmer(IsAlarmButtonPressed bool) error {
 	client.IsAlarmButtonPressed = IsAlarmButtonPressed
-	request, err := NewAlarmRequest(client).Serialize()
+	var request []byte
+	var requestID string
+	var err error
+	if len(client.Options.Zones) > 1 {
+		alarmBatchRequest := NewAlarmBatchRequest(client)
+		requestID = alarmBatchRequest.RequestID
+		request, err = alarmBatchRequest.Serialize()
+	} else {
+		alarmRequest := NewAlarmRequest(client)
+		requestID = alarmRequest.RequestID
+		request, err = alarmRequest.Serialize()
+	}
 	if err != nil {
-		client.ErrorLog.Println("Error while converting data:", err.Error())
-		client.Stop(false, 1)
+		return fmt.Errorf("unable to convert data, %s", err.Error())
 	}
+	client.checkServerProtocol()
+	startTime := time.Now()
+	retryInterval := InitialRetryInterval
 	for {
-		client.InfoLog.Println("Trying to send an alarm request to the server")
-		client.sendToServer(request)
+		client.InfoLog.Println("Trying to send an alarm request to the server, request ID:", requestID)
+		isDelivered, err := client.sendToServer(request)
+		if errors.Is(err, errRunFinished) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if isDelivered {
+			retryInterval = InitialRetryInterval
+		}
+		if client.Options.MaxRetryDuration > 0 &&
+			time.Since(startTime)+retryInterval > client.Options.MaxRetryDuration {
+			return fmt.Errorf("unable to send the alarm request within %s, giving up", client.Options.MaxRetryDuration)
+		}
+		client.InfoLog.Printf("Retrying in %s\n", retryInterval)
+		time.Sleep(retryInterval)
+		retryInterval *= 2
+		if retryInterval > MaxRetryInterval {
+			retryInterval = MaxRetryInterval
+		}
 	}
 }
 
@@ -378,140 +1600,666 @@ func (client *Client) Stop(IsPowerOffRequired bool, params ...int) {
 	os.Exit(exitCode)
 }
 
-func (client *Client) processAlarmButtonState() {
-	if client.IsAlarmButtonPressed {
-		client.Stop(client.IsAlarmButtonPressed)
+func (client *Client) Shutdown(ctx context.Context) error {
+	client.callMutex.Lock()
+	client.isClosing = true
+	client.callMutex.Unlock()
+	drainedChannel := make(chan struct{})
+	go func() {
+		client.inFlightCalls.Wait()
+		close(drainedChannel)
+	}()
+	select {
+	case <-drainedChannel:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("in-flight requests didn't finish in time, %s", ctx.Err().Error())
 	}
 }
 
+func (client *Client) beginCall() error {
+	client.callMutex.Lock()
+	defer client.callMutex.Unlock()
+	if client.isClosing {
+		return errors.New("the client is shutting down")
+	}
+	client.inFlightCalls.Add(1)
+	return nil
+}
+
+func (client *Client) processAlarmButtonState(stateResponse *StateResponse) error {
+	if !client.IsAlarmButtonPressed {
+		client.isAlarmReported = false
+		return nil
+	}
+	if client.actedStates.IsActedOn(stateResponse) {
+		if !client.isAlarmReported {
+			client.isAlarmReported = true
+			client.InfoLog.Println("The alarm state was already acted on, skipping it:", stateResponse.String())
+		}
+		return nil
+	}
+	switch client.Options.Action {
+	case NotifyAction:
+		if client.isAlarmReported {
+			return nil
+		}
+		client.isAlarmReported = true
+		client.actedStates.Remember(stateResponse)
+		client.InfoLog.Println("Showing the alarm notification")
+		err := ShowNotification("Alarm button", fmt.Sprintf("The alarm button was pressed (%s)", stateResponse.String()))
+		if err != nil {
+			client.ErrorLog.Println("Error while showing the alarm notification:", err.Error())
+		}
+	case CommandAction:
+		if client.isAlarmReported {
+			return nil
+		}
+		client.isAlarmReported = true
+		client.actedStates.Remember(stateResponse)
+		err := client.runAlarmCommand(stateResponse)
+		if err != nil {
+			client.ErrorLog.Println("Error while running the alarm command:", err.Error())
+		}
+	default:
+		if !IsSeverityAtLeast(stateResponse.Severity, client.Options.MinSeverity) {
+			return client.processBlockedShutdown(stateResponse)
+		}
+		err := client.shutdownPC()
+		if err != nil {
+			return fmt.Errorf("error during shutdown, %s", err.Error())
+		}
+		client.actedStates.Remember(stateResponse)
+		return errRunFinished
+	}
+	return nil
+}
+
+func (client *Client) processBlockedShutdown(stateResponse *StateResponse) error {
+	if client.isAlarmReported {
+		return nil
+	}
+	client.isAlarmReported = true
+	client.InfoLog.Printf("The alarm severity %s is below %s, the PC won't be turned off\n",
+		stateResponse.GetSeverity(), client.Options.MinSeverity)
+	switch client.Options.OnBlockedShutdown {
+	case ExitBlockedShutdown:
+		client.actedStates.Remember(stateResponse)
+		return ErrShutdownBlocked
+	case CommandBlockedShutdown:
+		client.actedStates.Remember(stateResponse)
+		err := client.runAlarmCommand(stateResponse)
+		if err != nil {
+			client.ErrorLog.Println("Error while running the alarm command:", err.Error())
+		}
+	}
+	return nil
+}
+
+func (client *Client) runAlarmCommand(stateResponse *StateResponse) error {
+	alarmCommand := CurrentSettings().AlarmCommand
+	if len(alarmCommand) == 0 {
+		return errors.New("the alarm command is not set in the settings")
+	}
+	client.InfoLog.Println("Running the alarm command:", strings.Join(alarmCommand, " "))
+	command := exec.Command(alarmCommand[0], alarmCommand[1:]...)
+	command.Env = append(os.Environ(),
+		fmt.Sprintf("ALARM_BUTTON_PRESSED=%t", stateResponse.IsAlarmButtonPressed),
+		fmt.Sprintf("ALARM_BUTTON_DATE_TIME=%s", stateResponse.DateTime.Format(time.RFC3339)),
+		fmt.Sprintf("ALARM_BUTTON_HOST=%s", stateResponse.Initiator.Host),
+		fmt.Sprintf("ALARM_BUTTON_USER=%s", stateResponse.Initiator.User),
+		fmt.Sprintf("ALARM_BUTTON_SEVERITY=%s", stateResponse.GetSeverity()),
+		fmt.Sprintf("ALARM_BUTTON_ZONE=%s", stateResponse.Zone),
+		fmt.Sprintf("ALARM_BUTTON_REASON=%s", stateResponse.Reason))
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+	err := command.Start()
+	if err != nil {
+		return err
+	}
+	go command.Wait()
+	return nil
+}
+
 func (client *Client) shutdownPC() error {
 	client.InfoLog.Println("Turning off the PC")
-	if client.debugMode {
-		return nil
-	} else {
-		osLC := strings.ToLower(client.OperatingSystem)
-		if strings.Contains(osLC, "linux") || strings.Contains(osLC, "darwin") {
-			return exec.Command("shutdown", "-h", "now").Start()
-		} else if strings.Contains(osLC, "windows") {
-			return exec.Command("shutdown.exe", "-s", "-f", "-t", "0").Start()
-		} else {
-			return fmt.Errorf("%s OS is not supported", client.OperatingSystem)
+	isDebugMode := client.Options != nil && client.Options.DebugMode
+	var shutdownDelay time.Duration
+	if client.Options != nil {
+		shutdownDelay = client.Options.ShutdownDelay
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client.shutdownMutex.Lock()
+	client.cancelShutdown = cancel
+	client.shutdownMutex.Unlock()
+	defer func() {
+		client.shutdownMutex.Lock()
+		client.cancelShutdown = nil
+		client.shutdownMutex.Unlock()
+	}()
+	if client.Options != nil && client.Options.GracePrompt > 0 && isInteractiveConsole() {
+		err := client.runGraceCountdown(ctx, client.Options.GracePrompt)
+		if err != nil {
+			return err
 		}
 	}
+	shutdownConfig := NewShutdownConfig(CurrentSettings(), shutdownDelay)
+	if client.commandRunner != nil {
+		shutdownConfig.CommandRunner = client.commandRunner
+	}
+	return shutdownConfig.Shutdown(ctx, client.OperatingSystem, isDebugMode, client.InfoLog)
 }
 
-func (client *Client) sendToServer(request []byte) {
-	connection, err := net.Dial("tcp", Settings.ServerSocket)
+func (client *Client) runGraceCountdown(ctx context.Context, gracePrompt time.Duration) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	deadline := time.Now().Add(gracePrompt)
+	for remaining := gracePrompt; remaining > 0; remaining = time.Until(deadline).Round(time.Second) {
+		fmt.Printf("The PC will be turned off in %s, press Ctrl+C to cancel\n", remaining)
+		select {
+		case <-ctx.Done():
+			client.InfoLog.Println("The shutdown countdown was cancelled")
+			return errors.New("the shutdown was cancelled during the countdown")
+		case <-ticker.C:
+		}
+	}
+	client.InfoLog.Println("The shutdown countdown has elapsed")
+	return nil
+}
+
+func isInteractiveConsole() bool {
+	fileInfo, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return fileInfo.Mode()&os.ModeCharDevice != 0
+}
+
+func (client *Client) cancelPendingShutdown() bool {
+	client.shutdownMutex.Lock()
+	defer client.shutdownMutex.Unlock()
+	if client.cancelShutdown == nil {
+		return false
+	}
+	client.cancelShutdown()
+	return true
+}
+
+func (client *Client) sendToServer(request []byte) (bool, error) {
+	message, err := client.exchangeWithServer(request)
 	if err != nil {
 		client.ErrorLog.Println("Failed to read server response:", err.Error())
-	} else {
-		connection.Write(request)
-		client.decodeServerResponse(connection)
+		return false, nil
+	}
+	err = client.decodeServerResponse(message)
+	return message.Type != "ErrorResponse", err
+}
+
+func (client *Client) QueryState() (*StateResponse, error) {
+	request, err := NewStateRequest(client).Serialize()
+	if err != nil {
+		return nil, err
+	}
+	message, err := client.exchangeWithServer(request)
+	if err != nil {
+		return nil, err
+	}
+	stateResponse := &StateResponse{}
+	err = UnmarshalServerReply(message, "StateResponse", stateResponse)
+	if err != nil {
+		return nil, err
+	}
+	return stateResponse, nil
+}
+
+func (client *Client) ServerInfo() (*ServerInfoResponse, error) {
+	request, err := NewServerInfoRequest(client).Serialize()
+	if err != nil {
+		return nil, err
+	}
+	message, err := client.exchangeWithServer(request)
+	if err != nil {
+		return nil, err
+	}
+	serverInfoResponse := &ServerInfoResponse{}
+	err = UnmarshalServerReply(message, "ServerInfoResponse", serverInfoResponse)
+	if err != nil {
+		return nil, err
+	}
+	return serverInfoResponse, nil
+}
+
+func (client *Client) checkServerProtocol() {
+	serverInfoResponse, err := client.ServerInfo()
+	if err != nil {
+		client.ErrorLog.Println("Unable to request the server version:", err.Error())
+		return
+	}
+	if serverInfoResponse.ProtocolVersion != ProtocolVersion {
+		client.ErrorLog.Printf("The server protocol version %d differs from the client protocol version %d, server: %s\n",
+			serverInfoResponse.ProtocolVersion, ProtocolVersion, serverInfoResponse.String())
+		return
+	}
+	if client.Options.DebugMode {
+		client.InfoLog.Println("Server information:", serverInfoResponse.String())
+	}
+}
+
+func UnmarshalServerReply(message *Message, expectedType string, reply interface{}) error {
+	if message.Type == "ErrorResponse" {
+		errorResponse := &ErrorResponse{}
+		err := json.Unmarshal(*message.Data, errorResponse)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("the server rejected the request, %s", errorResponse.String())
+	}
+	if message.Type != expectedType {
+		return fmt.Errorf("unexpected response from the server: %s", message.Type)
+	}
+	return json.Unmarshal(*message.Data, reply)
+}
+
+func (client *Client) exchangeWithServer(request []byte) (*Message, error) {
+	err := client.beginCall()
+	if err != nil {
+		return nil, err
+	}
+	defer client.inFlightCalls.Done()
+	settings := CurrentSettings()
+	connection, socketIndex, err := DialFromSettings(context.Background(), settings,
+		client.serverSocketIndex, client.ErrorLog)
+	if err != nil {
+		return nil, err
+	}
+	if !client.isServerSocketKnown || socketIndex != client.serverSocketIndex {
+		client.InfoLog.Println("Connected to the server", settings.GetServerSockets()[socketIndex])
+	}
+	client.serverSocketIndex = socketIndex
+	client.isServerSocketKnown = true
+	request, err = addMessageMetadata(request, client.metadata)
+	if err != nil {
 		connection.Close()
+		return nil, err
 	}
-	time.Sleep(clientSleepTime)
+	return exchangeOverConnection(connection, request, settings.RequestTimeout)
 }
 
-func (client *Client) decodeServerResponse(connection net.Conn) {
-	byteBuf := make([]byte, clientBufferSize)
-	bytesRead, err := connection.Read(byteBuf)
+func addMessageMetadata(request []byte, metadata map[string]string) ([]byte, error) {
+	if len(metadata) == 0 {
+		return request, nil
+	}
+	message := &Message{}
+	err := json.Unmarshal(request, message)
 	if err != nil {
-		client.ErrorLog.Println("Failed to read server response:", err.Error())
-	} else {
-		message := &Message{}
-		if err := json.Unmarshal(byteBuf[:bytesRead], &message); err != nil {
+		return nil, err
+	}
+	message.Metadata = metadata
+	return json.Marshal(message)
+}
+
+func ExchangeWithServer(serverSocket string, request []byte) (*Message, error) {
+	connection, err := DialServer(serverSocket)
+	if err != nil {
+		return nil, err
+	}
+	requestTimeout := DefaultRequestTimeout
+	if settings := CurrentSettings(); settings != nil {
+		requestTimeout = settings.RequestTimeout
+	}
+	return exchangeOverConnection(connection, request, requestTimeout)
+}
+
+func ExchangeFromSettings(ctx context.Context, settings *CommonSettings, request []byte) (*Message, error) {
+	connection, _, err := DialFromSettings(ctx, settings, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	return exchangeOverConnection(connection, request, settings.RequestTimeout)
+}
+
+func exchangeOverConnection(connection net.Conn, request []byte, requestTimeout time.Duration) (*Message, error) {
+	defer connection.Close()
+	deadline := time.Now().Add(requestTimeout)
+	if requestTimeout > 0 {
+		err := connection.SetDeadline(deadline)
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err := connection.Write(request)
+	if err == nil {
+		var message *Message
+		message, err = readServerMessage(connection)
+		if err == nil {
+			return message, nil
+		}
+	}
+	if requestTimeout > 0 && !time.Now().Before(deadline) {
+		return nil, fmt.Errorf("the server didn't answer within %s, %s", requestTimeout, err.Error())
+	}
+	return nil, err
+}
+
+func DialFromSettings(ctx context.Context, settings *CommonSettings,
+	firstSocketIndex int, errorLog *log.Logger) (net.Conn, int, error) {
+	if settings == nil {
+		return nil, 0, errors.New("settings are not filled")
+	}
+	serverSockets := settings.GetServerSockets()
+	lastError := errors.New("server address is not set")
+	for i := range serverSockets {
+		socketIndex := (firstSocketIndex + i) % len(serverSockets)
+		serverSocket := serverSockets[socketIndex]
+		connection, err := dialServerContext(ctx, serverSocket, settings.DialTimeout)
+		if err == nil {
+			return connection, socketIndex, nil
+		}
+		if errorLog != nil {
+			errorLog.Printf("Failed to connect to the server %s: %s\n", serverSocket, err.Error())
+		}
+		lastError = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, 0, lastError
+}
+
+func ParseServerAddress(serverSocket string) (string, string) {
+	if strings.HasPrefix(serverSocket, UnixSocketPrefix) {
+		return "unix", strings.TrimPrefix(serverSocket, UnixSocketPrefix)
+	}
+	return "tcp", serverSocket
+}
+
+func ValidateServerAddress(serverSocket string) error {
+	network, address := ParseServerAddress(serverSocket)
+	if network == "unix" {
+		if address == "" {
+			return fmt.Errorf("%s has no socket path", serverSocket)
+		}
+		return nil
+	}
+	_, err := net.ResolveTCPAddr(network, address)
+	return err
+}
+
+func DialServer(serverSocket string) (net.Conn, error) {
+	var dialTimeout time.Duration
+	if settings := CurrentSettings(); settings != nil {
+		dialTimeout = settings.DialTimeout
+	}
+	return dialServerContext(context.Background(), serverSocket, dialTimeout)
+}
+
+func dialServerContext(ctx context.Context, serverSocket string, dialTimeout time.Duration) (net.Conn, error) {
+	network, address := ParseServerAddress(serverSocket)
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	connection, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		var netError net.Error
+		if dialTimeout > 0 && ctx.Err() == nil && errors.As(err, &netError) && netError.Timeout() {
+			return nil, fmt.Errorf("could not connect to %s within %s", serverSocket, dialTimeout)
+		}
+		return nil, err
+	}
+	return connection, nil
+}
+
+func readServerMessage(connection net.Conn) (*Message, error) {
+	message := &Message{}
+	err := json.NewDecoder(io.LimitReader(connection, clientMaxMessageSize)).Decode(message)
+	if err != nil {
+		return nil, fmt.Errorf("error while parsing the message, %s", err.Error())
+	}
+	if message.Data == nil {
+		return nil, errors.New("the message has no data")
+	}
+	return message, nil
+}
+
+func (client *Client) decodeServerResponse(message *Message) error {
+	switch message.Type {
+	case "AlarmResponse":
+		alarmResponse := AlarmResponse{}
+		if err := json.Unmarshal(*message.Data, &alarmResponse); err != nil {
 			client.ErrorLog.Println("Error while parsing the message:", err.Error())
 		}
-		switch message.Type {
-		case "AlarmResponse":
-			alarmResponse := AlarmResponse{}
-			if err := json.Unmarshal(*message.Data, &alarmResponse); err != nil {
-				client.ErrorLog.Println("Error while parsing the message:", err.Error())
-			}
-			client.processServerResponse(alarmResponse)
-		case "StateResponse":
-			stateResponse := StateResponse{}
-			if err := json.Unmarshal(*message.Data, &stateResponse); err != nil {
-				client.ErrorLog.Println("Error while parsing the message:", err.Error())
-			}
-			client.processServerResponse(stateResponse)
-		default:
-			client.processServerResponse(message)
+		return client.processServerResponse(alarmResponse)
+	case "AlarmBatchResponse":
+		alarmBatchResponse := AlarmBatchResponse{}
+		if err := json.Unmarshal(*message.Data, &alarmBatchResponse); err != nil {
+			client.ErrorLog.Println("Error while parsing the message:", err.Error())
 		}
+		return client.processServerResponse(alarmBatchResponse)
+	case "StateResponse":
+		stateResponse := StateResponse{}
+		if err := json.Unmarshal(*message.Data, &stateResponse); err != nil {
+			client.ErrorLog.Println("Error while parsing the message:", err.Error())
+		}
+		return client.processServerResponse(stateResponse)
+	case "ErrorResponse":
+		errorResponse := ErrorResponse{}
+		if err := json.Unmarshal(*message.Data, &errorResponse); err != nil {
+			client.ErrorLog.Println("Error while parsing the message:", err.Error())
+		}
+		return client.processServerResponse(errorResponse)
+	default:
+		return client.processServerResponse(message)
 	}
 }
 
-func (client *Client) processServerResponse(response interface{}) {
+func (client *Client) processServerResponse(response interface{}) error {
 	switch response.(type) {
 	case AlarmResponse:
 		alarmResponse := response.(AlarmResponse)
 		client.InfoLog.Println("Alarm response received:", alarmResponse.String())
-		client.Stop(false)
+		if !client.isOwnAlarmResponse(&alarmResponse, client.Options.Zone) {
+			client.ErrorLog.Println("The alarm response doesn't confirm this request, retrying")
+			return nil
+		}
+		return errRunFinished
+	case AlarmBatchResponse:
+		alarmBatchResponse := response.(AlarmBatchResponse)
+		client.InfoLog.Println("Alarm batch response received:", alarmBatchResponse.String())
+		if len(alarmBatchResponse.Responses) != len(client.Options.Zones) {
+			client.ErrorLog.Println("The alarm batch response doesn't confirm this request, retrying")
+			return nil
+		}
+		for i, alarmResponse := range alarmBatchResponse.Responses {
+			if alarmResponse == nil || !client.isOwnAlarmResponse(alarmResponse, client.Options.Zones[i]) {
+				client.ErrorLog.Println("The alarm batch response doesn't confirm this request, retrying")
+				return nil
+			}
+		}
+		return errRunFinished
 	case StateResponse:
 		stateResponse := response.(StateResponse)
-		client.InfoLog.Println("Status check response received:", stateResponse.String())
+		isStateChanged := !client.isStateReceived || client.IsAlarmButtonPressed != stateResponse.IsAlarmButtonPressed
+		if isStateChanged || client.isPollLogged() {
+			client.InfoLog.Println("Status check response received:", stateResponse.String())
+		}
+		client.isStateReceived = true
 		client.IsAlarmButtonPressed = stateResponse.IsAlarmButtonPressed
-		client.processAlarmButtonState()
+		return client.processAlarmButtonState(&stateResponse)
+	case ErrorResponse:
+		errorResponse := response.(ErrorResponse)
+		if errorResponse.Code == UnauthenticatedError || errorResponse.Code == InvalidRequestError {
+			return fmt.Errorf("the server rejected the request, %s", errorResponse.String())
+		}
+		client.ErrorLog.Println("The server rejected the request:", errorResponse.String())
 	default:
 		client.InfoLog.Println("Other information received:", response)
 	}
+	return nil
+}
+
+func (client *Client) isPollLogged() bool {
+	if client.Options == nil || client.Options.LogSampling <= 1 {
+		return true
+	}
+	return (client.pollCount-1)%client.Options.LogSampling == 0
+}
+
+func (client *Client) isOwnAlarmResponse(alarmResponse *AlarmResponse, zone string) bool {
+	if alarmResponse.Sequence == 0 || alarmResponse.Initiator == nil {
+		return false
+	}
+	return alarmResponse.IsAlarmButtonPressed == client.IsAlarmButtonPressed &&
+		alarmResponse.Zone == zone &&
+		alarmResponse.Initiator.Equal(client.Initiator)
 }
 
 func SerializeWithTypeName(typeName string, entity interface{}) ([]byte, error) {
+	return SerializeWithRequestID(typeName, "", entity)
+}
+
+func SerializeWithRequestID(typeName string, requestID string, entity interface{}) ([]byte, error) {
 	byteMessage, err := json.Marshal(entity)
 	if err != nil {
 		return nil, err
 	}
 	data := json.RawMessage(byteMessage)
-	encodedMessage, err := json.Marshal(Message{typeName, &data})
+	encodedMessage, err := json.Marshal(Message{Type: typeName, RequestID: requestID, Data: &data})
 	if err != nil {
 		return nil, err
 	}
 	return encodedMessage, nil
 }
 
-func GetFileChecksum(fileName string) ([]byte, error) {
+func NewRequestID() string {
+	randomBytes := make([]byte, 8)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(randomBytes)
+}
+
+func GetFileChecksum(fileName string, checksumFunction crypto.Hash) ([]byte, error) {
 	contents, err := os.ReadFile(fileName)
 	if err != nil {
 		return nil, err
 	}
-	if !DefaultChecksumFunction.Available() {
-		return nil, errors.New("hash function is not available, checksum calculation is not possible")
+	hasher, err := NewChecksumHasher(checksumFunction)
+	if err != nil {
+		return nil, err
 	}
-	hasher := DefaultChecksumFunction.New()
 	hasher.Write(contents)
 	newFileChecksum := hasher.Sum(nil)
 
 	return newFileChecksum[:], nil
 }
 
+func NewChecksumHasher(checksumFunction crypto.Hash) (hash.Hash, error) {
+	if !checksumFunction.Available() {
+		return nil, errors.New("hash function is not available, checksum calculation is not possible")
+	}
+	return checksumFunction.New(), nil
+}
+
+func GetChecksumFunction(hashAlgorithm string) (crypto.Hash, error) {
+	var checksumFunction crypto.Hash
+	switch strings.ToLower(hashAlgorithm) {
+	case "", SHA512HashAlgorithm:
+		checksumFunction = crypto.SHA512
+	case SHA256HashAlgorithm:
+		checksumFunction = crypto.SHA256
+	default:
+		return 0, fmt.Errorf("the hash algorithm %s is not supported, expected sha512 or sha256", hashAlgorithm)
+	}
+	if !checksumFunction.Available() {
+		return 0, fmt.Errorf("the hash algorithm %s is not available", hashAlgorithm)
+	}
+	return checksumFunction, nil
+}
+
+// IsUpdaterRunningNow reports whether the updater of any user role is running.
 func IsUpdaterRunningNow(infoLog *log.Logger, errorLog *log.Logger) bool {
+	markerPaths := []string{GetUpdateMarkerPath("")}
+	if Settings == nil || Settings.MarkerPath == "" {
+		var err error
+		markerPaths, err = filepath.Glob(GetUpdateMarkerPath("*"))
+		if err != nil {
+			if errorLog != nil {
+				errorLog.Println("Error while looking for the update markers:", err.Error())
+			}
+			return true
+		}
+	}
+	if len(markerPaths) == 0 && infoLog != nil {
+		infoLog.Println("Update marker not found, trying to proceed further")
+	}
+	for _, markerPath := range markerPaths {
+		if isUpdateMarkerActive(markerPath, infoLog, errorLog) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRoleUpdaterRunningNow reports whether the updater of the user role is running.
+func IsRoleUpdaterRunningNow(userRole string, infoLog *log.Logger, errorLog *log.Logger) bool {
+	return isUpdateMarkerActive(GetUpdateMarkerPath(userRole), infoLog, errorLog)
+}
+
+func isUpdateMarkerActive(markerPath string, infoLog *log.Logger, errorLog *log.Logger) bool {
 	if infoLog != nil {
-		infoLog.Println("Checking for the presence of an update marker")
+		infoLog.Println("Checking for the presence of an update marker", markerPath)
 	}
-	funcResult := true
-	fileInfo, err := os.Stat(UpdateMarkerFileName)
+	fileInfo, err := os.Stat(markerPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			if infoLog != nil {
 				infoLog.Println("Update marker not found, trying to proceed further")
 			}
-			funcResult = false
-		} else {
-			if time.Since(fileInfo.ModTime()) > UpdateMarkerLifeTime {
-				if infoLog != nil {
-					infoLog.Println("The update marker is too old, perhaps the update is stuck. Trying to delete the file")
-				}
-				err = TerminateProcessByName(UpdaterExecutable)
-				funcResult = (err != nil)
-				if err == nil {
-					err = os.Remove(UpdateMarkerFileName)
-					funcResult = (err != nil)
-				}
-			}
+			return false
+		}
+		if errorLog != nil {
+			errorLog.Println("Error while checking the update marker:", err.Error())
 		}
+		return true
 	}
-	return funcResult
+	if time.Since(fileInfo.ModTime()) <= GetUpdateMarkerLifetime() {
+		return true
+	}
+	if infoLog != nil {
+		infoLog.Println("The update marker is too old, perhaps the update is stuck. Trying to delete the file")
+	}
+	err = TerminateProcessByName(UpdaterExecutable)
+	if err != nil {
+		if errorLog != nil {
+			errorLog.Println("Error while terminating the updater:", err.Error())
+		}
+		return true
+	}
+	err = os.Remove(markerPath)
+	if err != nil {
+		if errorLog != nil {
+			errorLog.Println("Error while deleting the update marker:", err.Error())
+		}
+		return true
+	}
+	return false
+}
+
+// GetUpdateMarkerPath returns the marker created by the updater of the user role.
+// By default it's kept next to the settings file rather than in the temporary
+// directory, which differs between the accounts of a PC.
+func GetUpdateMarkerPath(userRole string) string {
+	if Settings != nil && Settings.MarkerPath != "" {
+		return Settings.MarkerPath
+	}
+	return filepath.Join(filepath.Dir(GetSettingsFileName()), fmt.Sprintf(UpdateMarkerPattern, userRole))
+}
+
+func GetUpdateMarkerLifetime() time.Duration {
+	if Settings != nil && Settings.MarkerLifetime > 0 {
+		return Settings.MarkerLifetime
+	}
+	return UpdateMarkerLifeTime
 }
 
 func TerminateProcessByName(processNameToTerminate string) error {
@@ -0,0 +1,157 @@
+package entities
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Doctor struct {
+	output           io.Writer
+	isCriticalFailed bool
+}
+
+func HandleDoctorCommand() {
+	if len(os.Args) < 2 || os.Args[1] != "doctor" {
+		return
+	}
+	doctor := &Doctor{output: os.Stdout}
+	if !doctor.Run(context.Background()) {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func (doctor *Doctor) Run(ctx context.Context) bool {
+	err := ReadCommonSettingsFromFile()
+	if err != nil {
+		doctor.fail(true, fmt.Sprintf("the settings file %s is invalid: %s", GetSettingsFileName(), err.Error()),
+			fmt.Sprintf("put a valid %s next to the executable, alarm-packager can generate one", SettingsFileName))
+		return false
+	}
+	doctor.pass(fmt.Sprintf("the settings file %s is valid", GetSettingsFileName()))
+	doctor.checkServers()
+	doctor.checkUpdateFolder(ctx)
+	return !doctor.isCriticalFailed
+}
+
+func (doctor *Doctor) checkServers() {
+	initiator, err := NewInitiatorData()
+	if err != nil {
+		doctor.fail(true, "unable to determine the initiator: "+err.Error(),
+			fmt.Sprintf("set %s and %s", InitiatorHostEnvironmentVariable, InitiatorUserEnvironmentVariable))
+		return
+	}
+	stateRequest := &StateRequest{Initiator: initiator, RequestID: NewRequestID()}
+	request, err := stateRequest.Serialize()
+	if err != nil {
+		doctor.fail(true, "unable to form a status request: "+err.Error(), "")
+		return
+	}
+	isAnyServerReachable := false
+	for _, serverSocket := range Settings.GetServerSockets() {
+		message, err := ExchangeWithServer(serverSocket, request)
+		if err != nil {
+			doctor.fail(false, fmt.Sprintf("the server %s is not reachable: %s", serverSocket, err.Error()),
+				"make sure alarm-server is running and the port is not blocked by a firewall")
+			continue
+		}
+		stateResponse := &StateResponse{}
+		err = UnmarshalServerReply(message, "StateResponse", stateResponse)
+		if err != nil {
+			doctor.fail(false, fmt.Sprintf("the server %s didn't return the alarm state: %s", serverSocket, err.Error()),
+				"make sure the client and the server are of the same version")
+			continue
+		}
+		isAnyServerReachable = true
+		doctor.pass(fmt.Sprintf("the server %s returned the alarm state: %s", serverSocket, stateResponse.String()))
+	}
+	if !isAnyServerReachable {
+		doctor.fail(true, "none of the servers returned the alarm state", "check serverSocket in "+SettingsFileName)
+	}
+}
+
+func (doctor *Doctor) checkUpdateFolder(ctx context.Context) {
+	httpClient, err := NewHTTPClient(Settings)
+	if err != nil {
+		doctor.fail(false, "unable to create an HTTP client: "+err.Error(), "check the proxy settings")
+		return
+	}
+	data, err := ReadFileFromUpdateFolder(ctx, httpClient, Settings.ServerUpdateFolder, VersionFileName)
+	if err != nil {
+		doctor.fail(false, fmt.Sprintf("the updates folder %s is not reachable: %s",
+			Settings.ServerUpdateFolder, err.Error()),
+			"check serverUpdateFolder in "+SettingsFileName+" and that the update files were uploaded")
+		return
+	}
+	updateDescription := NewUpdateDescription()
+	err = yaml.Unmarshal(data, updateDescription)
+	if err != nil {
+		doctor.fail(false, "the update description is invalid: "+err.Error(), "run alarm-packager again")
+		return
+	}
+	err = updateDescription.CheckManifestVersion()
+	if err != nil {
+		doctor.fail(false, err.Error(), "replace alarm-updater with a newer version manually")
+		return
+	}
+	checksumFunction, err := updateDescription.GetChecksumFunction()
+	if err != nil {
+		doctor.fail(false, "the update description is invalid: "+err.Error(), "run alarm-packager again")
+		return
+	}
+	doctor.pass(fmt.Sprintf("the updates folder contains the version %s", updateDescription.VersionNumber))
+	if updateDescription.VersionNumber != CurrentVersion {
+		doctor.fail(false, fmt.Sprintf("the local version %s differs from the version %s in the updates folder",
+			CurrentVersion, updateDescription.VersionNumber), "run alarm-updater")
+	}
+	fileNames := make([]string, 0, len(updateDescription.Files))
+	for fileName := range updateDescription.Files {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+	staleFiles := make([]string, 0, len(fileNames))
+	for _, fileName := range fileNames {
+		if _, err := os.Stat(fileName); err != nil {
+			continue
+		}
+		serverFileChecksum, err := base64.StdEncoding.DecodeString(updateDescription.Files[fileName])
+		if err != nil {
+			staleFiles = append(staleFiles, fileName)
+			continue
+		}
+		localFileChecksum, err := GetFileChecksum(fileName, checksumFunction)
+		if err != nil || !bytes.Equal(serverFileChecksum, localFileChecksum) {
+			staleFiles = append(staleFiles, fileName)
+		}
+	}
+	if len(staleFiles) > 0 {
+		doctor.fail(false, "the local files differ from the updates folder: "+strings.Join(staleFiles, ", "),
+			"run alarm-updater")
+		return
+	}
+	doctor.pass("the local files match the updates folder")
+}
+
+func (doctor *Doctor) pass(message string) {
+	fmt.Fprintln(doctor.output, "[PASS]", message)
+}
+
+func (doctor *Doctor) fail(isCritical bool, message string, hint string) {
+	status := "[WARN]"
+	if isCritical {
+		status = "[FAIL]"
+		doctor.isCriticalFailed = true
+	}
+	fmt.Fprintln(doctor.output, status, message)
+	if hint != "" {
+		fmt.Fprintln(doctor.output, "       hint:", hint)
+	}
+}
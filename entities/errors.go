@@ -0,0 +1,24 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrAlreadyRunning      = errors.New("the updater is already running")
+	ErrServerUnreachable   = errors.New("the update server is unreachable")
+	ErrManifestUnavailable = errors.New("the update description is unavailable")
+	ErrAlarmPressed        = errors.New("the alarm button is pressed")
+	ErrShutdownBlocked     = errors.New("the alarm button is pressed, but the PC can't be turned off")
+	ErrS3UpdateFolder      = errors.New("the updater can't download from s3, set the http(s) address of the bucket")
+	errRunFinished         = errors.New("the client has finished its work")
+)
+
+type ChecksumMismatchError struct {
+	File string
+}
+
+func (checksumMismatchError *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("the checksum of the file %s doesn't match the server checksum", checksumMismatchError.File)
+}
@@ -0,0 +1,40 @@
+package entities
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExchangeWithServerTimesOutOnStalledServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	stalledConnections := make(chan net.Conn, 1)
+	go func() {
+		connection, err := listener.Accept()
+		if err == nil {
+			stalledConnections <- connection
+		}
+	}()
+	Settings = storeTestSettings(t, "serverSocket: "+listener.Addr().String()+
+		"\nupdateFolder: /updates\nrequestTimeout: 100ms\n")
+	client := newTestChecker(nil)
+	client.Initiator = &InitiatorData{Host: "host", User: "user"}
+	startTime := time.Now()
+	_, err = client.QueryState()
+	if err == nil || !strings.Contains(err.Error(), "didn't answer within 100ms") {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+	if elapsedTime := time.Since(startTime); elapsedTime > 2*time.Second {
+		t.Fatalf("expected the request to time out quickly, it took %s", elapsedTime)
+	}
+	select {
+	case connection := <-stalledConnections:
+		connection.Close()
+	default:
+	}
+}
@@ -0,0 +1,68 @@
+package entities
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+type idleTimeoutTransport struct {
+	transport http.RoundTripper
+	timeout   time.Duration
+}
+
+type idleTimeoutBody struct {
+	body       io.ReadCloser
+	timer      *time.Timer
+	cancel     context.CancelFunc
+	delay      time.Duration
+	isTimedOut int32
+}
+
+func (transport *idleTimeoutTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(request.Context())
+	response, err := transport.transport.RoundTrip(request.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return response, err
+	}
+	body := &idleTimeoutBody{
+		body:   response.Body,
+		cancel: cancel,
+		delay:  transport.timeout,
+	}
+	body.timer = time.AfterFunc(transport.timeout, func() {
+		atomic.StoreInt32(&body.isTimedOut, 1)
+		cancel()
+	})
+	response.Body = body
+	return response, nil
+}
+
+func (transport *idleTimeoutTransport) CloseIdleConnections() {
+	closer, isCloser := transport.transport.(interface{ CloseIdleConnections() })
+	if isCloser {
+		closer.CloseIdleConnections()
+	}
+}
+
+func (body *idleTimeoutBody) Read(buffer []byte) (int, error) {
+	count, err := body.body.Read(buffer)
+	if err != nil && err != io.EOF && atomic.LoadInt32(&body.isTimedOut) == 1 {
+		return count, fmt.Errorf("no data was received within %s, %s", body.delay, err.Error())
+	}
+	if count > 0 {
+		body.timer.Reset(body.delay)
+	}
+	return count, err
+}
+
+func (body *idleTimeoutBody) Close() error {
+	body.timer.Stop()
+	err := body.body.Close()
+	body.cancel()
+	return err
+}
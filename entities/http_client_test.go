@@ -0,0 +1,80 @@
+package entities
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testHTTPTimeout time.Duration = 200 * time.Millisecond
+
+func newTestHTTPClient(t *testing.T) *http.Client {
+	httpClient, err := NewHTTPClient(&CommonSettings{HTTPTimeout: testHTTPTimeout, DownloadConcurrency: 1})
+	if err != nil {
+		t.Fatalf("unable to create the HTTP client: %s", err.Error())
+	}
+	return httpClient
+}
+
+func TestHTTPClientTimesOutWaitingForHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		select {
+		case <-time.After(5 * testHTTPTimeout):
+		case <-request.Context().Done():
+		}
+	}))
+	defer server.Close()
+	response, err := newTestHTTPClient(t).Get(server.URL)
+	if err == nil {
+		response.Body.Close()
+		t.Fatal("expected the request to time out while waiting for the headers")
+	}
+}
+
+func TestHTTPClientTimesOutOnStalledBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte("partial"))
+		writer.(http.Flusher).Flush()
+		select {
+		case <-time.After(5 * testHTTPTimeout):
+		case <-request.Context().Done():
+		}
+	}))
+	defer server.Close()
+	response, err := newTestHTTPClient(t).Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	defer response.Body.Close()
+	_, err = io.ReadAll(response.Body)
+	if err == nil || !strings.Contains(err.Error(), "no data was received") {
+		t.Fatalf("expected the body read to time out, got %v", err)
+	}
+}
+
+func TestHTTPClientAllowsSlowTransfersThatKeepProgressing(t *testing.T) {
+	const chunkCount = 6
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		for i := 0; i < chunkCount; i++ {
+			writer.Write([]byte("chunk"))
+			writer.(http.Flusher).Flush()
+			time.Sleep(testHTTPTimeout / 2)
+		}
+	}))
+	defer server.Close()
+	response, err := newTestHTTPClient(t).Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("expected a transfer longer than the timeout to succeed, got %s", err.Error())
+	}
+	if string(body) != strings.Repeat("chunk", chunkCount) {
+		t.Fatalf("unexpected body %q", body)
+	}
+}
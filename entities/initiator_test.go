@@ -0,0 +1,42 @@
+package entities
+
+import "testing"
+
+func TestInitiatorDataClone(t *testing.T) {
+	var nilInitiator *InitiatorData
+	if nilInitiator.Clone() != nil {
+		t.Fatal("expected a nil initiator to be cloned as nil")
+	}
+	initiator := &InitiatorData{Host: "host", User: "user"}
+	clonedInitiator := initiator.Clone()
+	if clonedInitiator == initiator || !clonedInitiator.Equal(initiator) {
+		t.Fatalf("expected an equal copy, got %+v", clonedInitiator)
+	}
+	clonedInitiator.User = "other"
+	if initiator.User != "user" {
+		t.Fatal("expected the copy not to share the initiator")
+	}
+}
+
+func TestInitiatorDataEqual(t *testing.T) {
+	initiator := &InitiatorData{Host: "host", User: "user"}
+	testCases := []struct {
+		first   *InitiatorData
+		second  *InitiatorData
+		isEqual bool
+	}{
+		{nil, nil, true},
+		{initiator, nil, false},
+		{nil, initiator, false},
+		{initiator, initiator, true},
+		{initiator, &InitiatorData{Host: "host", User: "user"}, true},
+		{initiator, &InitiatorData{Host: "other", User: "user"}, false},
+		{initiator, &InitiatorData{Host: "host", User: "other"}, false},
+	}
+	for _, testCase := range testCases {
+		if isEqual := testCase.first.Equal(testCase.second); isEqual != testCase.isEqual {
+			t.Errorf("%+v and %+v: expected equal %t, got %t", testCase.first, testCase.second,
+				testCase.isEqual, isEqual)
+		}
+	}
+}
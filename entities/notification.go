@@ -0,0 +1,22 @@
+package entities
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+func ShowNotification(title string, message string) error {
+	osLC := strings.ToLower(runtime.GOOS)
+	if strings.Contains(osLC, "linux") {
+		return exec.Command("notify-send", "--urgency=critical", title, message).Run()
+	} else if strings.Contains(osLC, "darwin") {
+		script := fmt.Sprintf("display notification %q with title %q", message, title)
+		return exec.Command("osascript", "-e", script).Run()
+	} else if strings.Contains(osLC, "windows") {
+		return exec.Command("msg.exe", "*", fmt.Sprintf("%s: %s", title, message)).Run()
+	} else {
+		return fmt.Errorf("%s OS is not supported", runtime.GOOS)
+	}
+}
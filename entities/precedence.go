@@ -0,0 +1,44 @@
+package entities
+
+import (
+	"flag"
+	"time"
+)
+
+func IsFlagSet(flagSet *flag.FlagSet, name string) bool {
+	isSet := false
+	flagSet.Visit(func(setFlag *flag.Flag) {
+		if setFlag.Name == name {
+			isSet = true
+		}
+	})
+	return isSet
+}
+
+func ResolveServerAddress(settingsAddress string, flagAddress string) string {
+	if flagAddress != "" {
+		return flagAddress
+	}
+	return settingsAddress
+}
+
+func ResolveString(flagValue string, settingsValue string, defaultValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if settingsValue != "" {
+		return settingsValue
+	}
+	return defaultValue
+}
+
+func ResolveDuration(isFlagSet bool, flagValue time.Duration,
+	settingsValue time.Duration, defaultValue time.Duration) time.Duration {
+	if isFlagSet {
+		return flagValue
+	}
+	if settingsValue != 0 {
+		return settingsValue
+	}
+	return defaultValue
+}
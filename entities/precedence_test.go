@@ -0,0 +1,96 @@
+package entities
+
+import (
+	"flag"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestIsFlagSet(t *testing.T) {
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.SetOutput(ioutil.Discard)
+	flagSet.String("server-address", "", "")
+	flagSet.Duration("poll-interval", 0, "")
+	err := flagSet.Parse([]string{"-poll-interval", "0s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsFlagSet(flagSet, "poll-interval") {
+		t.Fatal("expected a flag set to its zero value to be reported as set")
+	}
+	if IsFlagSet(flagSet, "server-address") || IsFlagSet(flagSet, "missing") {
+		t.Fatal("expected flags that weren't passed to be reported as not set")
+	}
+}
+
+func TestResolveServerAddress(t *testing.T) {
+	testCases := []struct {
+		settingsAddress string
+		flagAddress     string
+		expectedAddress string
+	}{
+		{"", "", ""},
+		{"settings:8080", "", "settings:8080"},
+		{"", "flag:8080", "flag:8080"},
+		{"settings:8080", "flag:8080", "flag:8080"},
+	}
+	for _, testCase := range testCases {
+		address := ResolveServerAddress(testCase.settingsAddress, testCase.flagAddress)
+		if address != testCase.expectedAddress {
+			t.Errorf("settings %q, flag %q: expected %q, got %q", testCase.settingsAddress,
+				testCase.flagAddress, testCase.expectedAddress, address)
+		}
+	}
+}
+
+func TestResolveString(t *testing.T) {
+	testCases := []struct {
+		flagValue     string
+		settingsValue string
+		defaultValue  string
+		expectedValue string
+	}{
+		{"", "", "", ""},
+		{"", "", "default", "default"},
+		{"", "settings", "", "settings"},
+		{"", "settings", "default", "settings"},
+		{"flag", "", "", "flag"},
+		{"flag", "", "default", "flag"},
+		{"flag", "settings", "", "flag"},
+		{"flag", "settings", "default", "flag"},
+	}
+	for _, testCase := range testCases {
+		value := ResolveString(testCase.flagValue, testCase.settingsValue, testCase.defaultValue)
+		if value != testCase.expectedValue {
+			t.Errorf("flag %q, settings %q, default %q: expected %q, got %q", testCase.flagValue,
+				testCase.settingsValue, testCase.defaultValue, testCase.expectedValue, value)
+		}
+	}
+}
+
+func TestResolveDuration(t *testing.T) {
+	testCases := []struct {
+		isFlagSet     bool
+		flagValue     time.Duration
+		settingsValue time.Duration
+		defaultValue  time.Duration
+		expectedValue time.Duration
+	}{
+		{false, 0, 0, 0, 0},
+		{false, 0, 0, time.Minute, time.Minute},
+		{false, 0, time.Second, time.Minute, time.Second},
+		{false, time.Hour, 0, time.Minute, time.Minute},
+		{false, time.Hour, time.Second, time.Minute, time.Second},
+		{true, 0, time.Second, time.Minute, 0},
+		{true, time.Hour, 0, time.Minute, time.Hour},
+		{true, time.Hour, time.Second, time.Minute, time.Hour},
+	}
+	for _, testCase := range testCases {
+		value := ResolveDuration(testCase.isFlagSet, testCase.flagValue, testCase.settingsValue,
+			testCase.defaultValue)
+		if value != testCase.expectedValue {
+			t.Errorf("%+v: got %s", testCase, value)
+		}
+	}
+}
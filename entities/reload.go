@@ -0,0 +1,54 @@
+package entities
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+var activeSettings atomic.Value
+
+func CurrentSettings() *CommonSettings {
+	settings, isSettingsFound := activeSettings.Load().(*CommonSettings)
+	if !isSettingsFound {
+		return Settings
+	}
+	return settings
+}
+
+func ReloadCommonSettingsFromFile() (*CommonSettings, error) {
+	settingsFileName := GetSettingsFileName()
+	if settingsFileName == StandardInputFileName {
+		return CurrentSettings(), nil
+	}
+	data, err := os.ReadFile(settingsFileName)
+	if err != nil {
+		return nil, err
+	}
+	return decodeCommonSettings(data)
+}
+
+func HandleReloadSignal(infoLog *log.Logger, errorLog *log.Logger,
+	prepareSettings func(previous *CommonSettings, current *CommonSettings) []string) {
+	reloadChannel := make(chan os.Signal, 1)
+	signal.Notify(reloadChannel, syscall.SIGHUP)
+	go func() {
+		for range reloadChannel {
+			infoLog.Println("Reloading the settings from the file", GetSettingsFileName())
+			settings, err := ReloadCommonSettingsFromFile()
+			if err != nil {
+				errorLog.Println("Error while reloading the settings, the current settings are kept:", err.Error())
+				continue
+			}
+			if prepareSettings != nil {
+				for _, warning := range prepareSettings(CurrentSettings(), settings) {
+					errorLog.Println("WARNING:", warning)
+				}
+			}
+			activeSettings.Store(settings)
+			infoLog.Println("The settings were reloaded:", settings.String())
+		}
+	}()
+}
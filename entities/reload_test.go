@@ -0,0 +1,32 @@
+package entities
+
+import (
+	"testing"
+)
+
+func storeTestSettings(t *testing.T, data string) *CommonSettings {
+	settings, err := decodeCommonSettings([]byte(data))
+	if err != nil {
+		t.Fatalf("unable to decode the settings: %s", err.Error())
+	}
+	activeSettings.Store(settings)
+	return settings
+}
+
+func TestRequestsUseReloadedAuthToken(t *testing.T) {
+	Settings = storeTestSettings(t, "serverSocket: 127.0.0.1:8080\nupdateFolder: /updates\nauthToken: old\n")
+	client := &Client{Initiator: &InitiatorData{Host: "host", User: "user"}, Options: &ClientOptions{Zones: []string{"a", "b"}}}
+	if token := NewAlarmRequest(client).Token; token != "old" {
+		t.Fatalf("expected the initial token, got %q", token)
+	}
+	storeTestSettings(t, "serverSocket: 127.0.0.1:8080\nupdateFolder: /updates\nauthToken: new\n")
+	if token := NewAlarmRequest(client).Token; token != "new" {
+		t.Fatalf("expected the alarm request to use the reloaded token, got %q", token)
+	}
+	if token := NewAlarmBatchRequest(client).Token; token != "new" {
+		t.Fatalf("expected the alarm batch request to use the reloaded token, got %q", token)
+	}
+	if token := NewResetRequest(client.Initiator).Token; token != "new" {
+		t.Fatalf("expected the reset request to use the reloaded token, got %q", token)
+	}
+}
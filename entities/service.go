@@ -0,0 +1,22 @@
+package entities
+
+import "os"
+
+type serviceStopSignal struct{}
+
+func (serviceStopSignal) String() string {
+	return "service stop"
+}
+
+func (serviceStopSignal) Signal() {}
+
+// ServiceStopSignal is sent to the interrupt handler when the service control
+// manager stops the service, which unlike Ctrl+C is a clean exit.
+var ServiceStopSignal os.Signal = serviceStopSignal{}
+
+func GetInterruptExitCode(interruptSignal os.Signal) int {
+	if interruptSignal == ServiceStopSignal {
+		return 0
+	}
+	return 1
+}
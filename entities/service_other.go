@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package entities
+
+import (
+	"log"
+	"os"
+)
+
+func RunAsService(name string, interruptChannel chan<- os.Signal, errorLog *log.Logger, run func()) error {
+	errorLog.Printf("WARNING: the service mode is supported only on Windows, %s is running as a regular process\n", name)
+	run()
+	return nil
+}
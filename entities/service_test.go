@@ -0,0 +1,23 @@
+package entities
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestGetInterruptExitCode(t *testing.T) {
+	testCases := []struct {
+		interruptSignal os.Signal
+		exitCode        int
+	}{
+		{ServiceStopSignal, 0},
+		{os.Interrupt, 1},
+		{syscall.SIGTERM, 1},
+	}
+	for _, testCase := range testCases {
+		if exitCode := GetInterruptExitCode(testCase.interruptSignal); exitCode != testCase.exitCode {
+			t.Errorf("%s: expected the exit code %d, got %d", testCase.interruptSignal, testCase.exitCode, exitCode)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+//go:build windows
+// +build windows
+
+package entities
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+type serviceHandler struct {
+	run              func()
+	interruptChannel chan<- os.Signal
+}
+
+func RunAsService(name string, interruptChannel chan<- os.Signal, errorLog *log.Logger, run func()) error {
+	isWindowsService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+	if !isWindowsService {
+		return fmt.Errorf("%s wasn't started by the service control manager", name)
+	}
+	err = svc.Run(name, &serviceHandler{run: run, interruptChannel: interruptChannel})
+	if err != nil {
+		return err
+	}
+	// The interrupt handler drains the in-flight calls and exits the process.
+	select {}
+}
+
+func (handler *serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest,
+	statuses chan<- svc.Status) (bool, uint32) {
+	statuses <- svc.Status{State: svc.StartPending}
+	go handler.run()
+	statuses <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for request := range requests {
+		switch request.Cmd {
+		case svc.Interrogate:
+			statuses <- request.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			statuses <- svc.Status{State: svc.StopPending}
+			handler.interruptChannel <- ServiceStopSignal
+			return false, 0
+		}
+	}
+	return false, 0
+}
@@ -0,0 +1,32 @@
+package entities
+
+import "fmt"
+
+const (
+	InfoSeverity     string = "info"
+	WarningSeverity  string = "warning"
+	CriticalSeverity string = "critical"
+)
+
+var severityRanks = map[string]int{
+	InfoSeverity:     1,
+	WarningSeverity:  2,
+	CriticalSeverity: 3,
+}
+
+func ValidateSeverity(severity string) error {
+	if _, isSeverityFound := severityRanks[severity]; !isSeverityFound {
+		return fmt.Errorf("unknown severity %s, expected info, warning or critical", severity)
+	}
+	return nil
+}
+
+func IsSeverityAtLeast(severity string, threshold string) bool {
+	if severity == "" {
+		severity = CriticalSeverity
+	}
+	if threshold == "" {
+		threshold = CriticalSeverity
+	}
+	return severityRanks[severity] >= severityRanks[threshold]
+}
@@ -0,0 +1,149 @@
+package entities
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type CommandRunner func(command string, args ...string) error
+
+type ShutdownConfig struct {
+	Command       string
+	Args          []string
+	Delay         time.Duration
+	CommandRunner CommandRunner
+}
+
+func NewShutdownConfig(settings *CommonSettings, delay time.Duration) *ShutdownConfig {
+	shutdownConfig := &ShutdownConfig{Delay: delay, CommandRunner: startCommand}
+	if settings != nil && len(settings.ShutdownCommand) > 0 {
+		shutdownConfig.Command = settings.ShutdownCommand[0]
+		shutdownConfig.Args = settings.ShutdownCommand[1:]
+	}
+	return shutdownConfig
+}
+
+// GetScheduledDelay returns the delay the shutdown command actually waits:
+// the standard command accepts whole minutes on Linux and macOS and whole
+// seconds on Windows, so the delay is rounded up.
+func (shutdownConfig *ShutdownConfig) GetScheduledDelay(operatingSystem string) time.Duration {
+	if shutdownConfig.Command != "" || shutdownConfig.Delay <= 0 {
+		return shutdownConfig.Delay
+	}
+	osLC := strings.ToLower(operatingSystem)
+	if strings.Contains(osLC, "linux") || strings.Contains(osLC, "darwin") {
+		return time.Duration(math.Ceil(shutdownConfig.Delay.Minutes())) * time.Minute
+	}
+	return time.Duration(math.Ceil(shutdownConfig.Delay.Seconds())) * time.Second
+}
+
+func (shutdownConfig *ShutdownConfig) GetCommand(operatingSystem string) (string, []string, error) {
+	if shutdownConfig.Command != "" {
+		return shutdownConfig.Command, shutdownConfig.Args, nil
+	}
+	scheduledDelay := shutdownConfig.GetScheduledDelay(operatingSystem)
+	osLC := strings.ToLower(operatingSystem)
+	if strings.Contains(osLC, "linux") || strings.Contains(osLC, "darwin") {
+		if scheduledDelay <= 0 {
+			return "shutdown", []string{"-h", "now"}, nil
+		}
+		return "shutdown", []string{"-h", fmt.Sprintf("+%d", int64(scheduledDelay/time.Minute))}, nil
+	} else if strings.Contains(osLC, "windows") {
+		delaySeconds := int64(scheduledDelay / time.Second)
+		return "shutdown.exe", []string{"-s", "-f", "-t", strconv.FormatInt(delaySeconds, 10)}, nil
+	} else {
+		return "", nil, fmt.Errorf("%s OS is not supported", operatingSystem)
+	}
+}
+
+func (shutdownConfig *ShutdownConfig) GetCancelCommand(operatingSystem string) (string, []string, error) {
+	if shutdownConfig.Command != "" {
+		return "", nil, errors.New("a custom shutdown command can't be cancelled")
+	}
+	osLC := strings.ToLower(operatingSystem)
+	if strings.Contains(osLC, "linux") || strings.Contains(osLC, "darwin") {
+		return "shutdown", []string{"-c"}, nil
+	} else if strings.Contains(osLC, "windows") {
+		return "shutdown.exe", []string{"/a"}, nil
+	} else {
+		return "", nil, fmt.Errorf("%s OS is not supported", operatingSystem)
+	}
+}
+
+func (shutdownConfig *ShutdownConfig) Shutdown(ctx context.Context,
+	operatingSystem string, isDryRun bool, infoLog *log.Logger) error {
+	command, args, err := shutdownConfig.GetCommand(operatingSystem)
+	if err != nil {
+		return err
+	}
+	commandLine := strings.TrimSpace(command + " " + strings.Join(args, " "))
+	scheduledDelay := shutdownConfig.GetScheduledDelay(operatingSystem)
+	if scheduledDelay != shutdownConfig.Delay {
+		infoLog.Printf("Shutdown delay: %s, rounded up from %s to the precision of the shutdown command\n",
+			scheduledDelay, shutdownConfig.Delay)
+	} else if scheduledDelay > 0 {
+		infoLog.Println("Shutdown delay:", scheduledDelay)
+	}
+	if isDryRun {
+		infoLog.Println("Debug mode is on, the shutdown command would be:", commandLine)
+		return nil
+	}
+	if shutdownConfig.Command != "" {
+		return shutdownConfig.runCustomCommand(ctx, commandLine, infoLog)
+	}
+	infoLog.Println("Running the shutdown command:", commandLine)
+	err = shutdownConfig.CommandRunner(command, args...)
+	if err != nil || scheduledDelay <= 0 {
+		return err
+	}
+	delayTimer := time.NewTimer(scheduledDelay)
+	defer delayTimer.Stop()
+	select {
+	case <-delayTimer.C:
+		return nil
+	case <-ctx.Done():
+		return shutdownConfig.cancel(operatingSystem, ctx.Err(), infoLog)
+	}
+}
+
+// runCustomCommand waits for the delay itself before running the command:
+// a custom command can't be given the delay or be cancelled once it runs.
+func (shutdownConfig *ShutdownConfig) runCustomCommand(ctx context.Context,
+	commandLine string, infoLog *log.Logger) error {
+	if shutdownConfig.Delay > 0 {
+		delayTimer := time.NewTimer(shutdownConfig.Delay)
+		defer delayTimer.Stop()
+		select {
+		case <-delayTimer.C:
+		case <-ctx.Done():
+			infoLog.Println("The shutdown was cancelled before the delay elapsed")
+			return fmt.Errorf("the scheduled shutdown was cancelled, %w", ctx.Err())
+		}
+	}
+	infoLog.Println("Running the shutdown command:", commandLine)
+	return shutdownConfig.CommandRunner(shutdownConfig.Command, shutdownConfig.Args...)
+}
+
+func (shutdownConfig *ShutdownConfig) cancel(operatingSystem string, reason error, infoLog *log.Logger) error {
+	command, args, err := shutdownConfig.GetCancelCommand(operatingSystem)
+	if err != nil {
+		return fmt.Errorf("unable to cancel the scheduled shutdown, %s", err.Error())
+	}
+	infoLog.Println("Cancelling the scheduled shutdown:", strings.TrimSpace(command+" "+strings.Join(args, " ")))
+	err = shutdownConfig.CommandRunner(command, args...)
+	if err != nil {
+		return fmt.Errorf("unable to cancel the scheduled shutdown, %s", err.Error())
+	}
+	return fmt.Errorf("the scheduled shutdown was cancelled, %s", reason.Error())
+}
+
+func startCommand(command string, args ...string) error {
+	return exec.Command(command, args...).Start()
+}
@@ -0,0 +1,145 @@
+package entities
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShutdownConfigRoundsDelayToCommandPrecision(t *testing.T) {
+	testCases := []struct {
+		operatingSystem string
+		delay           time.Duration
+		scheduledDelay  time.Duration
+		commandLine     string
+	}{
+		{"linux", 0, 0, "shutdown -h now"},
+		{"linux", 30 * time.Second, time.Minute, "shutdown -h +1"},
+		{"darwin", 90 * time.Second, 2 * time.Minute, "shutdown -h +2"},
+		{"linux", 5 * time.Minute, 5 * time.Minute, "shutdown -h +5"},
+		{"windows", 0, 0, "shutdown.exe -s -f -t 0"},
+		{"windows", 1500 * time.Millisecond, 2 * time.Second, "shutdown.exe -s -f -t 2"},
+		{"windows", 30 * time.Second, 30 * time.Second, "shutdown.exe -s -f -t 30"},
+	}
+	for _, testCase := range testCases {
+		shutdownConfig := NewShutdownConfig(nil, testCase.delay)
+		scheduledDelay := shutdownConfig.GetScheduledDelay(testCase.operatingSystem)
+		command, args, err := shutdownConfig.GetCommand(testCase.operatingSystem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commandLine := command + " " + strings.Join(args, " ")
+		if scheduledDelay != testCase.scheduledDelay || commandLine != testCase.commandLine {
+			t.Errorf("%s %s: expected %s and %q, got %s and %q", testCase.operatingSystem, testCase.delay,
+				testCase.scheduledDelay, testCase.commandLine, scheduledDelay, commandLine)
+		}
+	}
+}
+
+func TestShutdownConfigKeepsDelayOfCustomCommand(t *testing.T) {
+	shutdownConfig := NewShutdownConfig(&CommonSettings{ShutdownCommand: []string{"poweroff"}}, 30*time.Second)
+	if scheduledDelay := shutdownConfig.GetScheduledDelay("linux"); scheduledDelay != 30*time.Second {
+		t.Fatalf("expected the delay of a custom command to be kept, got %s", scheduledDelay)
+	}
+}
+
+func TestShutdownCancelsScheduledShutdown(t *testing.T) {
+	commandLines := make([]string, 0, 2)
+	shutdownConfig := NewShutdownConfig(nil, 30*time.Second)
+	shutdownConfig.CommandRunner = func(command string, args ...string) error {
+		commandLines = append(commandLines, command+" "+strings.Join(args, " "))
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := shutdownConfig.Shutdown(ctx, "linux", false, log.New(ioutil.Discard, "", 0))
+	if err == nil {
+		t.Fatal("expected the cancelled shutdown to be reported")
+	}
+	if strings.Join(commandLines, ", ") != "shutdown -h +1, shutdown -c" {
+		t.Fatalf("expected the shutdown to be scheduled and cancelled, got %v", commandLines)
+	}
+}
+
+func newTestCustomShutdown(delay time.Duration, commandCount *int32) *ShutdownConfig {
+	shutdownConfig := NewShutdownConfig(&CommonSettings{ShutdownCommand: []string{"poweroff", "-f"}}, delay)
+	shutdownConfig.CommandRunner = func(command string, args ...string) error {
+		atomic.AddInt32(commandCount, 1)
+		return nil
+	}
+	return shutdownConfig
+}
+
+func TestShutdownRunsCustomCommandAfterDelay(t *testing.T) {
+	var commandCount int32
+	shutdownConfig := newTestCustomShutdown(200*time.Millisecond, &commandCount)
+	doneChannel := make(chan error, 1)
+	go func() {
+		doneChannel <- shutdownConfig.Shutdown(context.Background(), "linux", false, log.New(ioutil.Discard, "", 0))
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&commandCount) != 0 {
+		t.Fatal("expected the custom command not to run before the delay")
+	}
+	if err := <-doneChannel; err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&commandCount) != 1 {
+		t.Fatalf("expected the custom command to run once after the delay, ran %d times", commandCount)
+	}
+}
+
+func TestShutdownSkipsCancelledCustomCommand(t *testing.T) {
+	var commandCount int32
+	shutdownConfig := newTestCustomShutdown(time.Minute, &commandCount)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := shutdownConfig.Shutdown(ctx, "linux", false, log.New(ioutil.Discard, "", 0))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the cancellation to be returned, got %v", err)
+	}
+	if atomic.LoadInt32(&commandCount) != 0 {
+		t.Fatal("expected the cancelled custom command not to run")
+	}
+}
+
+func TestInterruptAfterShutdownIsNotSwallowed(t *testing.T) {
+	client := newTestChecker(func(command string, args ...string) error {
+		return errors.New("shutdown failed")
+	})
+	if client.shutdownPC() == nil {
+		t.Fatal("expected the failed shutdown to be reported")
+	}
+	if client.cancelPendingShutdown() {
+		t.Fatal("expected an interrupt after the shutdown returned to stop the client")
+	}
+}
+
+func TestInterruptCancelsPendingShutdown(t *testing.T) {
+	client := newTestChecker(func(command string, args ...string) error {
+		return nil
+	})
+	client.Options.ShutdownDelay = time.Minute
+	shutdownChannel := make(chan error, 1)
+	go func() {
+		shutdownChannel <- client.shutdownPC()
+	}()
+	deadline := time.Now().Add(time.Second)
+	for !client.cancelPendingShutdown() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the shutdown to be pending")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := <-shutdownChannel; err == nil {
+		t.Fatal("expected the cancelled shutdown to be reported")
+	}
+	if client.cancelPendingShutdown() {
+		t.Fatal("expected the next interrupt to stop the client")
+	}
+}
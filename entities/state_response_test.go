@@ -0,0 +1,31 @@
+package entities
+
+import "testing"
+
+func TestStateResponseCloneIsDeep(t *testing.T) {
+	state := newTestPressedState()
+	state.Initiator = &InitiatorData{Host: "host", User: "user"}
+	state.Zone = "north"
+	state.Reason = "fire"
+	clonedState := state.Clone()
+	if clonedState == state || clonedState.Initiator == state.Initiator {
+		t.Fatal("expected the clone not to share the state or its initiator")
+	}
+	if *clonedState.Initiator != *state.Initiator || clonedState.String() != state.String() {
+		t.Fatalf("expected an equal copy, got %s", clonedState.String())
+	}
+	clonedState.Initiator.Host = "other host"
+	clonedState.Initiator.User = "other user"
+	clonedState.Zone = "south"
+	clonedState.Reason = "flood"
+	clonedState.IsAlarmButtonPressed = false
+	clonedState.Sequence++
+	if state.Initiator.Host != "host" || state.Initiator.User != "user" || state.Zone != "north" ||
+		state.Reason != "fire" || !state.IsAlarmButtonPressed || state.Sequence != 7 {
+		t.Fatalf("expected the original state to be unchanged, got %s", state.String())
+	}
+	state.Initiator = nil
+	if state.Clone().Initiator != nil {
+		t.Fatal("expected a state without an initiator to be cloned without one")
+	}
+}
@@ -0,0 +1,80 @@
+package entities
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestUpdateDescriptionValidatePaths(t *testing.T) {
+	testCases := []struct {
+		name    string
+		files   []string
+		paths   map[string]string
+		isValid bool
+	}{
+		{name: "plain file names", files: []string{"alarm-checker.exe", "bin/alarm-server.exe"}, isValid: true},
+		{name: "relative install path", files: []string{"a.exe"}, paths: map[string]string{"a.exe": "bin/a.exe"},
+			isValid: true},
+		{name: "absolute install path", files: []string{"a.exe"}, paths: map[string]string{"a.exe": "/opt/alarm/a.exe"},
+			isValid: true},
+		{name: "parent reference in file name", files: []string{"../a.exe"}},
+		{name: "absolute file name", files: []string{"/etc/a.exe"}},
+		{name: "drive letter file name", files: []string{"C:\\a.exe"}},
+		{name: "parent reference in install path", files: []string{"a.exe"},
+			paths: map[string]string{"a.exe": "/opt/alarm/../../etc/a.exe"}},
+		{name: "backslash parent reference", files: []string{"a.exe"}, paths: map[string]string{"a.exe": "bin\\..\\..\\a.exe"}},
+		{name: "unclean install path", files: []string{"a.exe"}, paths: map[string]string{"a.exe": "bin//a.exe"}},
+		{name: "install path of unknown file", files: []string{"a.exe"}, paths: map[string]string{"b.exe": "b.exe"}},
+	}
+	for _, testCase := range testCases {
+		updateDescription := &UpdateDescription{Files: make(map[string]string, len(testCase.files)), Paths: testCase.paths}
+		for _, fileName := range testCase.files {
+			updateDescription.Files[fileName] = "checksum"
+		}
+		err := updateDescription.ValidatePaths()
+		if testCase.isValid && err != nil {
+			t.Errorf("%s: unexpected error: %s", testCase.name, err.Error())
+		}
+		if !testCase.isValid && err == nil {
+			t.Errorf("%s: expected an error", testCase.name)
+		}
+	}
+}
+
+func TestUpdateDescriptionValidateInstallRoots(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test uses Unix paths")
+	}
+	installRoots := []string{filepath.Clean("/opt/alarm")}
+	testCases := []struct {
+		targetPath string
+		isValid    bool
+	}{
+		{targetPath: "bin/a.exe", isValid: true},
+		{targetPath: "/opt/alarm/a.exe", isValid: true},
+		{targetPath: "/opt/alarm/bin/a.exe", isValid: true},
+		{targetPath: "/opt/alarmist/a.exe"},
+		{targetPath: "/etc/a.exe"},
+	}
+	for _, testCase := range testCases {
+		updateDescription := &UpdateDescription{
+			Files: map[string]string{"a.exe": "checksum"},
+			Paths: map[string]string{"a.exe": testCase.targetPath},
+		}
+		err := updateDescription.ValidateInstallRoots(installRoots)
+		if testCase.isValid && err != nil {
+			t.Errorf("%s: unexpected error: %s", testCase.targetPath, err.Error())
+		}
+		if !testCase.isValid && err == nil {
+			t.Errorf("%s: expected an error", testCase.targetPath)
+		}
+	}
+	updateDescription := &UpdateDescription{
+		Files: map[string]string{"a.exe": "checksum"},
+		Paths: map[string]string{"a.exe": "/opt/alarm/a.exe"},
+	}
+	if updateDescription.ValidateInstallRoots(nil) == nil {
+		t.Error("expected absolute install paths to be rejected without install roots")
+	}
+}
@@ -0,0 +1,147 @@
+package entities
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type UpdateFile struct {
+	Body              io.ReadCloser
+	ContentLength     int64
+	Offset            int64
+	IsResumeSupported bool
+}
+
+type UpdateFetcher interface {
+	Fetch(ctx context.Context, fileName string, offset int64) (*UpdateFile, error)
+}
+
+func NewUpdateFetcher(updateFolder string, httpClient *http.Client) (UpdateFetcher, error) {
+	localFolder, isLocal, err := GetLocalUpdateFolder(updateFolder)
+	if err != nil {
+		return nil, err
+	}
+	if isLocal {
+		return &fileUpdateFetcher{folder: localFolder}, nil
+	}
+	updateFolderURL, err := url.Parse(updateFolder)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(updateFolderURL.Scheme) {
+	case "http", "https":
+		return &httpUpdateFetcher{updateFolder: updateFolder, httpClient: httpClient}, nil
+	case "s3":
+		return nil, fmt.Errorf("%w, %s", ErrS3UpdateFolder, updateFolder)
+	default:
+		return nil, fmt.Errorf("downloading updates from the folder with the %s scheme is not supported, "+
+			"expected http, https, file or an absolute path", updateFolderURL.Scheme)
+	}
+}
+
+func GetLocalUpdateFolder(updateFolder string) (string, bool, error) {
+	if filepath.IsAbs(updateFolder) {
+		return updateFolder, true, nil
+	}
+	updateFolderURL, err := url.Parse(updateFolder)
+	if err != nil {
+		return "", false, err
+	}
+	if !strings.EqualFold(updateFolderURL.Scheme, "file") {
+		return "", false, nil
+	}
+	localFolder := updateFolderURL.Path
+	if len(localFolder) > 2 && localFolder[0] == '/' && localFolder[2] == ':' {
+		localFolder = localFolder[1:]
+	}
+	return filepath.FromSlash(localFolder), true, nil
+}
+
+type httpUpdateFetcher struct {
+	updateFolder string
+	httpClient   *http.Client
+}
+
+func (fetcher *httpUpdateFetcher) Fetch(ctx context.Context, fileName string, offset int64) (*UpdateFile, error) {
+	response, err := GetFileBodyFromUpdateFolder(ctx, fetcher.httpClient, fetcher.updateFolder, fileName, offset)
+	if err != nil {
+		if response != nil {
+			response.Body.Close()
+		}
+		return nil, err
+	}
+	updateFile := &UpdateFile{
+		Body:              response.Body,
+		ContentLength:     response.ContentLength,
+		IsResumeSupported: response.Header.Get("Accept-Ranges") == "bytes",
+	}
+	if response.StatusCode == http.StatusPartialContent {
+		updateFile.Offset = offset
+		updateFile.IsResumeSupported = true
+	}
+	return updateFile, nil
+}
+
+type fileUpdateFetcher struct {
+	folder string
+}
+
+func (fetcher *fileUpdateFetcher) Fetch(ctx context.Context, fileName string, offset int64) (*UpdateFile, error) {
+	file, err := os.Open(filepath.Join(fetcher.folder, filepath.FromSlash(fileName)))
+	if err != nil {
+		return nil, err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if offset > fileInfo.Size() {
+		offset = 0
+	}
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &UpdateFile{
+		Body:              file,
+		ContentLength:     fileInfo.Size() - offset,
+		Offset:            offset,
+		IsResumeSupported: true,
+	}, nil
+}
+
+type MemoryUpdateFetcher struct {
+	Files map[string][]byte
+}
+
+func NewMemoryUpdateFetcher(files map[string][]byte) *MemoryUpdateFetcher {
+	return &MemoryUpdateFetcher{Files: files}
+}
+
+func (fetcher *MemoryUpdateFetcher) Fetch(ctx context.Context, fileName string, offset int64) (*UpdateFile, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	contents, isFileFound := fetcher.Files[fileName]
+	if !isFileFound {
+		return nil, fmt.Errorf("%s, %w", fileName, os.ErrNotExist)
+	}
+	if offset > int64(len(contents)) {
+		offset = 0
+	}
+	return &UpdateFile{
+		Body:              io.NopCloser(bytes.NewReader(contents[offset:])),
+		ContentLength:     int64(len(contents)) - offset,
+		Offset:            offset,
+		IsResumeSupported: true,
+	}, nil
+}
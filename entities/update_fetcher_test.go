@@ -0,0 +1,142 @@
+package entities
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readTestUpdateFile(t *testing.T, fetcher UpdateFetcher, fileName string, offset int64) (*UpdateFile, string) {
+	t.Helper()
+	updateFile, err := fetcher.Fetch(context.Background(), fileName, offset)
+	if err != nil {
+		t.Fatalf("unable to fetch the file: %s", err.Error())
+	}
+	defer updateFile.Body.Close()
+	contents, err := io.ReadAll(updateFile.Body)
+	if err != nil {
+		t.Fatalf("unable to read the file: %s", err.Error())
+	}
+	return updateFile, string(contents)
+}
+
+func TestGetLocalUpdateFolder(t *testing.T) {
+	testCases := []struct {
+		updateFolder string
+		localFolder  string
+		isLocal      bool
+	}{
+		{"/srv/updates", "/srv/updates", true},
+		{"file:///srv/updates", "/srv/updates", true},
+		{"FILE:///srv/updates", "/srv/updates", true},
+		{"http://updates.local/alarm-button", "", false},
+		{"s3://bucket/alarm-button", "", false},
+	}
+	for _, testCase := range testCases {
+		localFolder, isLocal, err := GetLocalUpdateFolder(testCase.updateFolder)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", testCase.updateFolder, err.Error())
+		}
+		if isLocal != testCase.isLocal || localFolder != filepath.FromSlash(testCase.localFolder) {
+			t.Fatalf("%s: expected %q (local %t), got %q (local %t)", testCase.updateFolder,
+				testCase.localFolder, testCase.isLocal, localFolder, isLocal)
+		}
+	}
+}
+
+func TestFileUpdateFetcherReadsFromOffset(t *testing.T) {
+	directory := t.TempDir()
+	err := os.WriteFile(filepath.Join(directory, "file"), []byte("0123456789"), DefaultFileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetcher, err := NewUpdateFetcher(directory, http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updateFile, contents := readTestUpdateFile(t, fetcher, "file", 4)
+	if contents != "456789" || updateFile.Offset != 4 || updateFile.ContentLength != 6 ||
+		!updateFile.IsResumeSupported {
+		t.Fatalf("unexpected file %+v with the contents %q", updateFile, contents)
+	}
+	updateFile, contents = readTestUpdateFile(t, fetcher, "file", 20)
+	if contents != "0123456789" || updateFile.Offset != 0 {
+		t.Fatalf("expected an offset past the end to restart the file, got %q from %d", contents, updateFile.Offset)
+	}
+	_, err = fetcher.Fetch(context.Background(), "missing", 0)
+	if !os.IsNotExist(err) {
+		t.Fatalf("expected a missing file error, got %v", err)
+	}
+}
+
+func TestHTTPUpdateFetcherResumesWithRange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		http.ServeContent(writer, request, "file", time.Time{}, strings.NewReader("0123456789"))
+	}))
+	defer server.Close()
+	fetcher, err := NewUpdateFetcher(server.URL+"/updates/", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	updateFile, contents := readTestUpdateFile(t, fetcher, "file", 0)
+	if contents != "0123456789" || updateFile.Offset != 0 || !updateFile.IsResumeSupported {
+		t.Fatalf("unexpected file %+v with the contents %q", updateFile, contents)
+	}
+	updateFile, contents = readTestUpdateFile(t, fetcher, "file", 4)
+	if contents != "456789" || updateFile.Offset != 4 {
+		t.Fatalf("expected the file from the offset, got %q from %d", contents, updateFile.Offset)
+	}
+}
+
+func TestHTTPUpdateFetcherReportsErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	fetcher, err := NewUpdateFetcher(server.URL+"/", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fetcher.Fetch(context.Background(), "file", 0)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+}
+
+func TestMemoryUpdateFetcher(t *testing.T) {
+	fetcher := NewMemoryUpdateFetcher(map[string][]byte{"file": []byte("0123456789")})
+	updateFile, contents := readTestUpdateFile(t, fetcher, "file", 4)
+	if contents != "456789" || updateFile.Offset != 4 || updateFile.ContentLength != 6 {
+		t.Fatalf("unexpected file %+v with the contents %q", updateFile, contents)
+	}
+	_, err := fetcher.Fetch(context.Background(), "missing", 0)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected a missing file error, got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = fetcher.Fetch(ctx, "file", 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a canceled context error, got %v", err)
+	}
+}
+
+func TestNewUpdateFetcherRejectsUnsupportedSchemes(t *testing.T) {
+	for _, updateFolder := range []string{"ftp://updates.local/", "s3://bucket/alarm-button", "updates/alarm-button"} {
+		_, err := NewUpdateFetcher(updateFolder, http.DefaultClient)
+		if err == nil {
+			t.Errorf("%q: expected the folder to be rejected", updateFolder)
+		}
+	}
+	for _, updateFolder := range []string{"http://updates.local/", "HTTPS://updates.local/", "file:///srv/updates"} {
+		_, err := NewUpdateFetcher(updateFolder, http.DefaultClient)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", updateFolder, err.Error())
+		}
+	}
+}
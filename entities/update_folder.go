@@ -0,0 +1,110 @@
+package entities
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+func ValidateUpdateFolder(updateFolder string) error {
+	if filepath.IsAbs(updateFolder) {
+		return nil
+	}
+	updateFolderURL, err := url.ParseRequestURI(updateFolder)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(updateFolderURL.Scheme) {
+	case "http", "https":
+		if updateFolderURL.Host == "" {
+			return fmt.Errorf("%s has no host", updateFolder)
+		}
+	case "s3":
+		if updateFolderURL.Host == "" {
+			return fmt.Errorf("%s has no bucket", updateFolder)
+		}
+	case "file":
+	default:
+		return fmt.Errorf("unsupported scheme %s in %s, expected http, https, file, s3 or an absolute path",
+			updateFolderURL.Scheme, updateFolder)
+	}
+	return nil
+}
+
+// ValidateDownloadFolder checks the updates folder the updater downloads from.
+// The packager uploads to s3 folders, but the updater only reads them over http(s).
+func ValidateDownloadFolder(updateFolder string) error {
+	err := ValidateUpdateFolder(updateFolder)
+	if err != nil {
+		return err
+	}
+	if isS3UpdateFolder(updateFolder) {
+		return fmt.Errorf("%w, %s", ErrS3UpdateFolder, updateFolder)
+	}
+	return nil
+}
+
+func isS3UpdateFolder(updateFolder string) bool {
+	updateFolderURL, err := url.Parse(updateFolder)
+	return err == nil && strings.EqualFold(updateFolderURL.Scheme, "s3")
+}
+
+func GetFileBodyFromUpdateFolder(ctx context.Context, httpClient *http.Client,
+	updateFolder string, fileName string, offset int64) (*http.Response, error) {
+	serverUpdateURL, err := url.Parse(updateFolder)
+	if err != nil {
+		return nil, err
+	}
+	serverUpdateURL.Path = path.Join(serverUpdateURL.Path, fileName)
+	finalURL := serverUpdateURL.String()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, finalURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	SetUpdateHTTPHeaders(request)
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		if ctx.Err() != nil {
+			return response, err
+		}
+		return response, fmt.Errorf("%w, %s", ErrServerUnreachable, err.Error())
+	}
+	isPartialContent := offset > 0 && response.StatusCode == http.StatusPartialContent
+	if response.StatusCode != http.StatusOK && !isPartialContent {
+		return response, fmt.Errorf("%s, %s", finalURL, response.Status)
+	}
+	return response, err
+}
+
+func SetUpdateHTTPHeaders(request *http.Request) {
+	request.Header.Set("User-Agent", DefaultUserAgent)
+	settings := CurrentSettings()
+	if settings == nil {
+		return
+	}
+	for headerName, headerValue := range settings.UpdateHTTPHeaders {
+		request.Header.Set(headerName, headerValue)
+	}
+}
+
+func ReadFileFromUpdateFolder(ctx context.Context, httpClient *http.Client,
+	updateFolder string, fileName string) ([]byte, error) {
+	fetcher, err := NewUpdateFetcher(updateFolder, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	updateFile, err := fetcher.Fetch(ctx, fileName, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer updateFile.Body.Close()
+	return io.ReadAll(updateFile.Body)
+}
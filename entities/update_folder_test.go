@@ -0,0 +1,55 @@
+package entities
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestValidateUpdateFolder(t *testing.T) {
+	testCases := []struct {
+		updateFolder string
+		isValid      bool
+	}{
+		{"http://updates.local/alarm-button/", true},
+		{"HTTPS://updates.local:8443/alarm-button", true},
+		{"file:///srv/updates", true},
+		{"s3://bucket/alarm-button", true},
+		{"/srv/updates", true},
+		{"htp://updates.local/alarm-button", false},
+		{"ftp://updates.local/alarm-button", false},
+		{"http:///alarm-button", false},
+		{"https:/alarm-button", false},
+		{"s3:///alarm-button", false},
+		{"updates/alarm-button", false},
+		{"", false},
+	}
+	for _, testCase := range testCases {
+		err := ValidateUpdateFolder(testCase.updateFolder)
+		if (err == nil) != testCase.isValid {
+			t.Errorf("%q: expected valid %t, got the error %v", testCase.updateFolder, testCase.isValid, err)
+		}
+	}
+}
+
+func TestDecodeCommonSettingsRejectsInvalidUpdateFolder(t *testing.T) {
+	_, err := decodeCommonSettings([]byte("serverSocket: 127.0.0.1:8080\nupdateFolder: htp://updates.local/\n"))
+	if err == nil {
+		t.Fatal("expected an invalid updates folder to be rejected")
+	}
+}
+
+func TestValidateDownloadFolderRejectsS3(t *testing.T) {
+	err := ValidateDownloadFolder("s3://bucket/alarm-button")
+	if !errors.Is(err, ErrS3UpdateFolder) {
+		t.Fatalf("expected ErrS3UpdateFolder, got %v", err)
+	}
+	_, err = NewUpdateFetcher("s3://bucket/alarm-button", http.DefaultClient)
+	if !errors.Is(err, ErrS3UpdateFolder) {
+		t.Fatalf("expected ErrS3UpdateFolder from the fetcher, got %v", err)
+	}
+	err = ValidateDownloadFolder("https://bucket.s3.amazonaws.com/alarm-button/")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+}
@@ -0,0 +1,46 @@
+package entities
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateMarkersAreKeptPerRoleNextToSettings(t *testing.T) {
+	directory := t.TempDir()
+	previousSettingsFileName, isSettingsFileNameSet := os.LookupEnv(SettingsFileEnvironmentVariable)
+	os.Setenv(SettingsFileEnvironmentVariable, filepath.Join(directory, SettingsFileName))
+	previousSettings := Settings
+	Settings = &CommonSettings{}
+	defer func() {
+		Settings = previousSettings
+		if isSettingsFileNameSet {
+			os.Setenv(SettingsFileEnvironmentVariable, previousSettingsFileName)
+		} else {
+			os.Unsetenv(SettingsFileEnvironmentVariable)
+		}
+	}()
+	clientMarkerPath := GetUpdateMarkerPath("client")
+	serverMarkerPath := GetUpdateMarkerPath("server")
+	if filepath.Dir(clientMarkerPath) != directory || clientMarkerPath == serverMarkerPath {
+		t.Fatalf("expected separate markers next to the settings file, got %s and %s",
+			clientMarkerPath, serverMarkerPath)
+	}
+	if IsUpdaterRunningNow(nil, nil) {
+		t.Fatal("expected no updater to be running without markers")
+	}
+	err := os.WriteFile(serverMarkerPath, nil, DefaultFileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsRoleUpdaterRunningNow("client", nil, nil) {
+		t.Fatal("expected the server marker not to block the client updater")
+	}
+	if !IsRoleUpdaterRunningNow("server", nil, nil) || !IsUpdaterRunningNow(nil, nil) {
+		t.Fatal("expected the server marker to be found")
+	}
+	Settings.MarkerPath = filepath.Join(directory, "custom.bin")
+	if GetUpdateMarkerPath("client") != Settings.MarkerPath || IsUpdaterRunningNow(nil, nil) {
+		t.Fatal("expected the marker path from the settings to be used")
+	}
+}
@@ -0,0 +1,65 @@
+package entities
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const (
+	TextVersionOutput string = "text"
+	JSONVersionOutput string = "json"
+)
+
+var (
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+type VersionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+}
+
+func GetVersionInfo() *VersionInfo {
+	return &VersionInfo{
+		Version:   CurrentVersion,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+	}
+}
+
+func (info *VersionInfo) String() string {
+	return fmt.Sprintf("version: %s, commit: %s, build time: %s", info.Version, info.Commit, info.BuildTime)
+}
+
+func (info *VersionInfo) JSON() ([]byte, error) {
+	return json.Marshal(info)
+}
+
+func HandleVersionCommand() {
+	if len(os.Args) < 2 || os.Args[1] != "version" {
+		return
+	}
+	versionFlags := flag.NewFlagSet("version", flag.ExitOnError)
+	outputPointer := versionFlags.String("output", TextVersionOutput, "output format (text or json)")
+	versionFlags.Parse(os.Args[2:])
+	info := GetVersionInfo()
+	switch *outputPointer {
+	case TextVersionOutput:
+		fmt.Println(info.String())
+	case JSONVersionOutput:
+		contents, err := info.JSON()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error while converting data:", err.Error())
+			os.Exit(1)
+		}
+		fmt.Println(string(contents))
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown output format %s\n", *outputPointer)
+		os.Exit(2)
+	}
+	os.Exit(0)
+}
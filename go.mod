@@ -3,10 +3,14 @@ module github.com/oshokin/alarm-button
 go 1.16
 
 require (
+	github.com/aws/aws-sdk-go v1.44.100
 	github.com/doitdistributed/go-update v0.0.0-20210408142833-fae09717712d
+	github.com/hashicorp/go-version v1.6.0
 	github.com/lestrrat-go/file-rotatelogs v2.4.0+incompatible
 	github.com/lestrrat-go/strftime v1.0.4 // indirect
-	github.com/mitchellh/go-ps v1.0.0 // indirect
+	github.com/mitchellh/go-ps v1.0.0
 	github.com/pkg/errors v0.9.1 // indirect
+	golang.org/x/sync v0.1.0
+	golang.org/x/sys v0.0.0-20211216021012-1d35b9e2eb4e
 	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
 )